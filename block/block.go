@@ -30,9 +30,16 @@ type Type interface {
 	Name() string
 	New(Param) (Block, error)
 
-	Verify(Param) error // verify parameters
-	Input() TypeInputMap
-	Accept(in PortTypeMap) (PortTypeMap, error) // tests wether type accepts in, and what it would return in this case
+	Verify(Param) error  // verify parameters
+	Params() []ParamSpec // parameters, nil if the type has none
+
+	// Input reports the inputs of blocks created using p. If p is nil,
+	// inputs are reported for ProtoParam.
+	Input(p Param) TypeInputMap
+
+	// Accept tests wether blocks created using p accept in, and what they
+	// would return in this case. A nil p is handled like in Input.
+	Accept(p Param, in PortTypeMap) (PortTypeMap, error)
 }
 
 type TypeMap map[string]Type
@@ -42,11 +49,18 @@ var DefaultTypeMap = make(TypeMap)
 func Register(name string, fn func() Block) {
 	RegisterType(&Proto{name, true, func(Param) (Block, error) {
 		return fn(), nil
-	}})
+	}, nil, false, nil})
+}
+
+// RegisterParam registers a type that uses the parameters specs.
+func RegisterParam(name string, fn func(Param) (Block, error), specs ...ParamSpec) {
+	RegisterType(&Proto{name, true, fn, specs, false, nil})
 }
 
-func RegisterParam(name string, fn func(Param) (Block, error)) {
-	RegisterType(&Proto{name, true, fn})
+// RegisterParamPorts registers a type like RegisterParam,
+// but the ports of its blocks depend on their parameters.
+func RegisterParamPorts(name string, fn func(Param) (Block, error), specs ...ParamSpec) {
+	RegisterType(&Proto{name, true, fn, specs, true, nil})
 }
 
 func RegisterType(t Type) {
@@ -59,38 +73,57 @@ func RegisterType(t Type) {
 // Proto is a simple block type that implements input and output port
 // reporting using a prototype block.
 type Proto struct {
-	TypeName  string
-	NeedInput bool
-	Create    func(Param) (Block, error)
+	TypeName    string
+	NeedInput   bool
+	Create      func(Param) (Block, error)
+	Specs       []ParamSpec
+	ParamPorts  bool // ports depend on parameters
+	Description *TypeDoc
 }
 
 func (t *Proto) Name() string               { return t.TypeName }
 func (t *Proto) New(p Param) (Block, error) { return t.Create(p) }
+func (t *Proto) Params() []ParamSpec        { return t.Specs }
+func (t *Proto) Doc() *TypeDoc              { return t.Description }
 
+// Verify creates a block using p, and reports values out of range of Specs.
 func (t *Proto) Verify(p Param) error {
-	blk, err := t.Create(p)
+	cp := &checkParam{Param: p, specs: t.Specs}
+	blk, err := t.Create(cp)
 	if c, ok := blk.(Closer); ok {
 		c.Close()
 	}
-	return err
-}
-
-func (t *Proto) Input() TypeInputMap {
-	blk, err := t.Create(ProtoParam)
 	if err != nil {
-		panic(fmt.Sprintf("Proto '%s' does not accept ProtoParam", t.TypeName))
+		return err
 	}
+	return cp.err
+}
+
+func (t *Proto) Input(p Param) TypeInputMap {
+	blk := t.proto(p)
 	if c, ok := blk.(Closer); ok {
 		defer c.Close()
 	}
 	return blk.Input()
 }
 
-func (t *Proto) Accept(i PortTypeMap) (PortTypeMap, error) {
+// proto creates a block for reporting ports. Blocks are created using p
+// only if ports depend on parameters, and p is valid.
+func (t *Proto) proto(p Param) Block {
+	if p != nil && t.ParamPorts {
+		if blk, err := t.Create(p); err == nil {
+			return blk
+		}
+	}
 	blk, err := t.Create(ProtoParam)
 	if err != nil {
 		panic(fmt.Sprintf("Proto '%s' does not accept ProtoParam", t.TypeName))
 	}
+	return blk
+}
+
+func (t *Proto) Accept(p Param, i PortTypeMap) (PortTypeMap, error) {
+	blk := t.proto(p)
 	if c, ok := blk.(Closer); ok {
 		defer c.Close()
 	}
@@ -109,7 +142,7 @@ func (t *Proto) Accept(i PortTypeMap) (PortTypeMap, error) {
 		if typ == Invalid || typ == Any {
 			return nil, fmt.Errorf("Proto '%s' can't test invalid/untyped input '%s'", t.TypeName, name)
 		}
-		if err = blki.Set(name, ZeroValue(typ)); err != nil {
+		if err := blki.Set(name, ZeroValue(typ)); err != nil {
 			return nil, fmt.Errorf("Proto '%s' does not accept zero input for '%s': %v", t.TypeName, name, err)
 		}
 	}
@@ -0,0 +1,230 @@
+// Package blocktest implements a harness for testing block types.
+//
+// A Harness creates a single block, connects stub ports to its inputs
+// and runs it for a number of ticks. Input values are changed and
+// outputs checked in between:
+//
+//	h, err := blocktest.New("toggle", nil, 1000)
+//	...
+//	h.Run(t, []blocktest.Step{
+//		{Tick: 0, Set: blocktest.Values{"": true}, Want: blocktest.Values{"": true}},
+//		{Tick: 5, Set: blocktest.Values{"": false}, Want: blocktest.Values{"": true}},
+//		{Tick: 9, Set: blocktest.Values{"": true}, Want: blocktest.Values{"": false}},
+//	})
+package blocktest
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/tajtiattila/joyster/block"
+)
+
+// Values maps port names to bool, float64 or int values.
+type Values map[string]interface{}
+
+// Harness runs a single block.
+type Harness struct {
+	Type  block.Type
+	Block block.Block
+
+	tickfreq  float64
+	ticks     int
+	ports     map[string]block.Port
+	validated bool
+}
+
+// New creates a block of the type typ registered in block.DefaultTypeMap
+// with parameters p and tickfreq ticks per second.
+func New(typ string, p map[string]interface{}, tickfreq float64) (*Harness, error) {
+	t, ok := block.DefaultTypeMap[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type '%s'", typ)
+	}
+	return NewType(t, p, tickfreq)
+}
+
+// NewType creates a block of type t with parameters p and tickfreq ticks per second.
+// Parameters are checked using t.Verify first, like when configs are loaded.
+func NewType(t block.Type, p map[string]interface{}, tickfreq float64) (*Harness, error) {
+	if err := t.Verify(NewParam(p, tickfreq)); err != nil {
+		return nil, fmt.Errorf("'%s': %v", t.Name(), err)
+	}
+	param := NewParam(p, tickfreq)
+	blk, err := t.New(param)
+	if err != nil {
+		return nil, err
+	}
+	if err := param.Err(); err != nil {
+		if c, ok := blk.(block.Closer); ok {
+			c.Close()
+		}
+		return nil, fmt.Errorf("'%s': %v", t.Name(), err)
+	}
+	return &Harness{
+		Type:     t,
+		Block:    blk,
+		tickfreq: tickfreq,
+		ports:    make(map[string]block.Port),
+	}, nil
+}
+
+// Ticks returns the number of ticks run so far.
+func (h *Harness) Ticks() int { return h.ticks }
+
+// TicksFor returns the number of ticks within d seconds.
+func (h *Harness) TicksFor(d float64) int { return int(d * h.tickfreq) }
+
+// Set sets the value of the stub port connected to the input sel.
+// The stub port is created and connected upon the first call for sel,
+// its type is set according to v, which must be bool, float64 or int.
+func (h *Harness) Set(sel string, v interface{}) error {
+	if p, ok := h.ports[sel]; ok {
+		switch x := p.(type) {
+		case *bool:
+			if b, ok := v.(bool); ok {
+				*x = b
+				return nil
+			}
+		case *float64:
+			if f, ok := v.(float64); ok {
+				*x = f
+				return nil
+			}
+		case *int:
+			if i, ok := v.(int); ok {
+				*x = i
+				return nil
+			}
+		}
+		return fmt.Errorf("input '%s' is %s, can't set to %#v", sel, block.PortString(p), v)
+	}
+	var p block.Port
+	switch x := v.(type) {
+	case bool:
+		p = &x
+	case float64:
+		p = &x
+	case int:
+		p = &x
+	default:
+		return fmt.Errorf("invalid value for input '%s': %#v", sel, v)
+	}
+	im := h.Block.Input()
+	if im == nil {
+		return fmt.Errorf("'%s' has no inputs", h.Type.Name())
+	}
+	if err := im.Set(sel, p); err != nil {
+		return err
+	}
+	h.ports[sel] = p
+	return nil
+}
+
+// SetAll calls Set for all values in v.
+func (h *Harness) SetAll(v Values) error {
+	for sel, x := range v {
+		if err := h.Set(sel, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step runs the block for n ticks. The block is validated before the first tick.
+func (h *Harness) Step(n int) error {
+	if n > 0 && !h.validated {
+		if err := h.Block.Validate(); err != nil {
+			return err
+		}
+		h.validated = true
+	}
+	t, _ := h.Block.(block.Ticker)
+	for i := 0; i < n; i++ {
+		if t != nil {
+			t.Tick()
+		}
+		h.ticks++
+	}
+	return nil
+}
+
+// Output returns the value of the output sel.
+func (h *Harness) Output(sel string) (interface{}, error) {
+	om := h.Block.Output()
+	if om == nil {
+		return nil, fmt.Errorf("'%s' has no outputs", h.Type.Name())
+	}
+	p, err := om.Get(sel)
+	if err != nil {
+		return nil, err
+	}
+	switch x := p.(type) {
+	case *bool:
+		return *x, nil
+	case *float64:
+		return *x, nil
+	case *int:
+		return *x, nil
+	}
+	return nil, fmt.Errorf("output '%s' invalid", sel)
+}
+
+// Close closes the block if it is a block.Closer.
+func (h *Harness) Close() error {
+	if c, ok := h.Block.(block.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Step is a scripted step for Run.
+type Step struct {
+	Tick int    // tick to set inputs before
+	Set  Values // inputs to set
+	Want Values // expected outputs after Tick
+}
+
+// Run runs the block according to script. For each step, the block is run
+// until it reaches Tick, then Set is applied and the block is ticked once.
+// Outputs in Want are checked afterwards. Float values are
+// compared with a tolerance of 1e-9.
+func (h *Harness) Run(t testing.TB, script []Step) {
+	t.Helper()
+	for _, s := range script {
+		if s.Tick < h.ticks {
+			t.Fatalf("'%s': step at tick %d after tick %d", h.Type.Name(), s.Tick, h.ticks)
+		}
+		if err := h.Step(s.Tick - h.ticks); err != nil {
+			t.Fatalf("'%s': %v", h.Type.Name(), err)
+		}
+		if err := h.SetAll(s.Set); err != nil {
+			t.Fatalf("'%s' tick %d: %v", h.Type.Name(), s.Tick, err)
+		}
+		if err := h.Step(1); err != nil {
+			t.Fatalf("'%s': %v", h.Type.Name(), err)
+		}
+		for sel, want := range s.Want {
+			got, err := h.Output(sel)
+			if err != nil {
+				t.Errorf("'%s' tick %d: %v", h.Type.Name(), s.Tick, err)
+				continue
+			}
+			if !Equal(got, want) {
+				t.Errorf("'%s' tick %d: output '%s' is %v, want %v", h.Type.Name(), s.Tick, sel, got, want)
+			}
+		}
+	}
+}
+
+// Equal reports if port values a and b are equal.
+// Float values are compared with a tolerance of 1e-9.
+func Equal(a, b interface{}) bool {
+	fa, aok := a.(float64)
+	fb, bok := b.(float64)
+	if aok && bok {
+		return math.Abs(fa-fb) <= 1e-9
+	}
+	return a == b
+}
@@ -0,0 +1,104 @@
+package blocktest
+
+import (
+	"testing"
+
+	"github.com/tajtiattila/joyster/block"
+	_ "github.com/tajtiattila/joyster/block/logic"
+)
+
+var blocktests = []struct {
+	typ    string
+	param  map[string]interface{}
+	script []Step
+}{
+	{"toggle", nil, []Step{
+		{Tick: 0, Set: Values{"": true}, Want: Values{"": true}},
+		{Tick: 5, Set: Values{"": false}, Want: Values{"": true}},
+		{Tick: 9, Set: Values{"": true}, Want: Values{"": false}},
+		{Tick: 10, Set: Values{"set": true}, Want: Values{"": true}},
+		{Tick: 11, Set: Values{"reset": true}, Want: Values{"": false}},
+	}},
+	{"doublebutton", map[string]interface{}{"TapDelay": 0.2, "KeepPushed": 0.25}, []Step{
+		{Tick: 0, Set: Values{"": true}, Want: Values{"": true, "double": false}},
+		{Tick: 50, Set: Values{"": false}, Want: Values{"": false, "double": false}},
+		{Tick: 100, Set: Values{"": true}, Want: Values{"": false, "double": true}},
+		{Tick: 150, Set: Values{"": false}, Want: Values{"": false, "double": true}},
+		{Tick: 349, Want: Values{"double": true}},
+		{Tick: 350, Want: Values{"": false, "double": false}},
+	}},
+	{"multibutton", map[string]interface{}{"NumTaps": 3, "TapDelay": 0.2, "KeepPushed": 0.25}, []Step{
+		{Tick: 0, Set: Values{"": true}},
+		{Tick: 50, Set: Values{"": false}},
+		{Tick: 100, Set: Values{"": true}},
+		{Tick: 150, Set: Values{"": false}},
+		{Tick: 298, Want: Values{"1": false, "2": false, "3": false}},
+		{Tick: 299, Want: Values{"1": false, "2": true, "3": false}},
+		{Tick: 547, Want: Values{"2": true}},
+		{Tick: 548, Want: Values{"2": false}},
+	}},
+	{"combo", map[string]interface{}{"TapDelay": 0.4, "KeepPushed": 0.25}, []Step{
+		{Tick: 0, Set: Values{"": block.HatCentre}},
+		{Tick: 10, Set: Values{"": block.HatNorth}, Want: Values{"": block.HatCentre}},
+		{Tick: 50, Set: Values{"": block.HatCentre}},
+		{Tick: 100, Set: Values{"": block.HatEast}, Want: Values{"n": block.HatEast, "": block.HatCentre}},
+		{Tick: 348, Want: Values{"n": block.HatEast}},
+		{Tick: 349, Want: Values{"n": block.HatCentre}},
+		{Tick: 400, Set: Values{"": block.HatCentre}},
+		{Tick: 500, Set: Values{"": block.HatSouth}},
+		{Tick: 899, Want: Values{"": block.HatCentre}},
+		{Tick: 900, Want: Values{"": block.HatSouth, "s": block.HatCentre}},
+	}},
+	{"incremental", map[string]interface{}{"Speed": 1}, []Step{
+		{Tick: 0, Set: Values{"": 1.0}},
+		{Tick: 499, Want: Values{"": 0.5}},
+		{Tick: 500, Set: Values{"": 0.0}, Want: Values{"": 0.5}},
+		{Tick: 600, Want: Values{"": 0.5}},
+	}},
+	{"incremental", map[string]interface{}{"Speed": 1, "QuickCenter": 1}, []Step{
+		{Tick: 0, Set: Values{"": 1.0}},
+		{Tick: 499, Want: Values{"": 0.5}},
+		{Tick: 500, Set: Values{"": -1.0}, Want: Values{"": 0.0}},
+	}},
+	{"deadzone", map[string]interface{}{"Threshold": 0.1}, []Step{
+		{Tick: 0, Set: Values{"": 0.05}, Want: Values{"": 0.0}},
+		{Tick: 1, Set: Values{"": 0.55}, Want: Values{"": 0.45}},
+		{Tick: 2, Set: Values{"": -0.55}, Want: Values{"": -0.45}},
+	}},
+}
+
+func TestBlocks(t *testing.T) {
+	for _, bt := range blocktests {
+		h, err := New(bt.typ, bt.param, 1000)
+		if err != nil {
+			t.Errorf("%s: %v", bt.typ, err)
+			continue
+		}
+		h.Run(t, bt.script)
+		h.Close()
+	}
+}
+
+func TestMissingParam(t *testing.T) {
+	if _, err := New("deadzone", nil, 1000); err == nil {
+		t.Error("deadzone without Threshold accepted")
+	}
+}
+
+func TestBadParam(t *testing.T) {
+	for _, tt := range []struct {
+		typ   string
+		param map[string]interface{}
+	}{
+		{"deadzone", map[string]interface{}{"Threshold": "0.1"}},
+		{"deadzone", map[string]interface{}{"Threshold": 1.5}},
+		{"deadzone", map[string]interface{}{"Threshold": 0.1, "Treshold": 0.2}},
+		{"delay", map[string]interface{}{"Type": Ident("boolean")}},
+		{"delay", map[string]interface{}{"Type": "bool"}},
+	} {
+		if h, err := New(tt.typ, tt.param, 1000); err == nil {
+			t.Errorf("%s %v accepted", tt.typ, tt.param)
+			h.Close()
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package blocktest
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
+	_ "github.com/tajtiattila/joyster/block/device/vjoy"
+	_ "github.com/tajtiattila/joyster/block/device/xinput"
+	"github.com/tajtiattila/joyster/block/trace"
+)
+
+// conformanceParams has the parameters used to create
+// blocks of types that need them.
+var conformanceParams = map[string]map[string]interface{}{
+	"offset":           {"Value": 0.1},
+	"deadzone":         {"Threshold": 0.1},
+	"multiply":         {"Factor": 1.25},
+	"curvature":        {"Factor": 0.5},
+	"truncate":         {"Value": 0.8},
+	"dampen":           {"Value": 0.2},
+	"smooth":           {"Time": 0.1},
+	"incremental":      {"Speed": 1, "Rebound": 0.5, "QuickCenter": 1},
+	"circulardeadzone": {"Threshold": 0.1},
+	"headlook":         {"MovePerSec": 2, "AutoCenterDist": 0.2, "AutoCenterAccel": 0.001, "JumpToCenterAccel": 0.1},
+	"pedals":           {"AxisThreshold": 0.15, "BreakThreshold": 0.05, "Exp": 1.5},
+	"multibutton":      {"NumTaps": 3, "TapDelay": 0.2, "KeepPushed": 0.25},
+	"doublebutton":     {"TapDelay": 0.2, "KeepPushed": 0.25},
+	"combo":            {"TapDelay": 0.2, "KeepPushed": 0.25},
+}
+
+// unbounded lists types whose axis outputs may leave the range -1..1
+// or become NaN even for inputs within range.
+var unbounded = map[string]string{
+	"add":          "arithmetic",
+	"sub":          "arithmetic",
+	"mul":          "arithmetic",
+	"div":          "arithmetic",
+	"mod":          "arithmetic",
+	"pow":          "arithmetic",
+	"offset":       "adds a constant",
+	"multiply":     "multiplies by a constant",
+	"circlesquare": "maps the unit circle onto the square, inputs outside the circle exceed range",
+}
+
+// conformanceDevices sets up a device.Default that is usable
+// by all device block types, including replay.
+func conformanceDevices() func() {
+	saved := device.Default
+	device.Default = trace.NewIdlePlayer(device.NewFake(), 1)
+	return func() { device.Default = saved }
+}
+
+func typeNames() []string {
+	var v []string
+	for n := range block.DefaultTypeMap {
+		v = append(v, n)
+	}
+	sort.Strings(v)
+	return v
+}
+
+func TestConformance(t *testing.T) {
+	defer conformanceDevices()()
+	rnd := rand.New(rand.NewSource(1))
+	for _, name := range typeNames() {
+		typ := block.DefaultTypeMap[name]
+		if typ.Name() != name {
+			t.Errorf("'%s' registered as '%s'", typ.Name(), name)
+		}
+
+		// ProtoParam
+		pblk, err := typ.New(block.ProtoParam)
+		if err != nil {
+			t.Errorf("'%s' does not accept ProtoParam: %v", name, err)
+			continue
+		}
+		closeblk(pblk)
+
+		h, err := NewType(typ, conformanceParams[name], 1000)
+		if err != nil {
+			t.Errorf("'%s' can't be created (missing conformanceParams?): %v", name, err)
+			continue
+		}
+		checkInputs(t, name, typ.Input(nil), h.Block.Input())
+		checkRandom(t, h, rnd)
+		checkAllocs(t, h)
+		h.Close()
+	}
+}
+
+// specParam records the arguments read by a block type.
+type specParam struct {
+	block.Param
+	read map[string]block.ParamSpec
+}
+
+func (p *specParam) Arg(n string) float64 {
+	p.read[n] = block.ParamSpec{Name: n, Required: true}
+	return p.Param.Arg(n)
+}
+
+func (p *specParam) OptArg(n string, d float64) float64 {
+	p.read[n] = block.ParamSpec{Name: n, Default: d}
+	return p.Param.OptArg(n, d)
+}
+
+func (p *specParam) OptIdentArg(n string, d string, choices ...string) string {
+	p.read[n] = block.ParamSpec{Name: n, Unit: block.Identifier, Choices: append([]string{d}, choices...)}
+	return p.Param.OptIdentArg(n, d, choices...)
+}
+
+// TestParamSpecs checks that types declare the parameters they read,
+// and that the values in conformanceParams are within range.
+func TestParamSpecs(t *testing.T) {
+	defer conformanceDevices()()
+	for _, name := range typeNames() {
+		typ := block.DefaultTypeMap[name]
+		p := &specParam{NewParam(conformanceParams[name], 1000), make(map[string]block.ParamSpec)}
+		blk, err := typ.New(p)
+		if err != nil {
+			t.Errorf("'%s' can't be created: %v", name, err)
+			continue
+		}
+		closeblk(blk)
+		specs := typ.Params()
+		for n, r := range p.read {
+			var s *block.ParamSpec
+			for i := range specs {
+				if specs[i].Name == n {
+					s = &specs[i]
+				}
+			}
+			switch {
+			case s == nil:
+				t.Errorf("'%s' reads undeclared parameter '%s'", name, n)
+			case s.Required != r.Required:
+				t.Errorf("'%s' parameter '%s' declared required=%v, read required=%v", name, n, s.Required, r.Required)
+			case !s.Required && s.Default != r.Default:
+				t.Errorf("'%s' parameter '%s' declared default %v, read default %v", name, n, s.Default, r.Default)
+			case s.Unit == block.Identifier && !identspec(s.Choices, r.Choices):
+				t.Errorf("'%s' parameter '%s' declared choices %v, read default and choices %v", name, n, s.Choices, r.Choices)
+			}
+		}
+		for _, s := range specs {
+			if _, ok := p.read[s.Name]; !ok {
+				t.Errorf("'%s' declares parameter '%s' not read", name, s.Name)
+			}
+		}
+		if err := typ.Verify(NewParam(conformanceParams[name], 1000)); err != nil {
+			t.Errorf("'%s' conformance parameters rejected: %v", name, err)
+		}
+	}
+}
+
+// identspec reports if read, the default followed by the choices
+// of an identifier argument, matches the choices declared.
+func identspec(declared, read []string) bool {
+	if len(read) != len(declared)+1 || read[0] != declared[0] {
+		return false
+	}
+	for i, c := range declared {
+		if read[i+1] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// TestTypeDocs checks that types are documented, and the
+// documentation refers to existing ports and parameters.
+func TestTypeDocs(t *testing.T) {
+	cats := make(map[string]bool)
+	for _, c := range block.Categories {
+		cats[c.Name] = true
+	}
+	for _, name := range typeNames() {
+		ti, err := block.Info(block.DefaultTypeMap[name])
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !cats[ti.Doc.Category] || ti.Doc.Summary == "" {
+			t.Errorf("'%s' category '%s' or summary '%s' invalid", name, ti.Doc.Category, ti.Doc.Summary)
+		}
+		for n := range ti.Doc.Ports {
+			if !hasPort(ti.Inputs, n) && !hasPort(ti.Outputs, n) {
+				t.Errorf("'%s' documents unknown port '%s'", name, n)
+			}
+		}
+		for n := range ti.Doc.Params {
+			found := false
+			for _, s := range ti.Params {
+				found = found || s.Name == n
+			}
+			if !found {
+				t.Errorf("'%s' documents unknown parameter '%s'", name, n)
+			}
+		}
+	}
+}
+
+func hasPort(v []block.PortInfo, n string) bool {
+	for _, p := range v {
+		if p.Name == n {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParamRange(t *testing.T) {
+	typ := block.DefaultTypeMap["deadzone"]
+	if err := typ.Verify(NewParam(map[string]interface{}{"Threshold": 1.5}, 1000)); err == nil {
+		t.Error("deadzone Threshold=1.5 accepted")
+	}
+	if err := typ.Verify(NewParam(map[string]interface{}{"Threshold": 0.5}, 1000)); err != nil {
+		t.Error("deadzone Threshold=0.5 rejected:", err)
+	}
+}
+
+func closeblk(blk block.Block) {
+	if c, ok := blk.(block.Closer); ok {
+		c.Close()
+	}
+}
+
+func checkInputs(t *testing.T, name string, tim block.TypeInputMap, bim block.InputMap) {
+	if tim == nil || bim == nil {
+		if (tim == nil) != (bim == nil) {
+			t.Errorf("'%s' type and block inputs differ: %v, %v", name, tim, bim)
+		}
+		return
+	}
+	tn, bn := tim.Names(), bim.Names()
+	if len(tn) != len(bn) {
+		t.Errorf("'%s' type has inputs %q, block has %q", name, tn, bn)
+		return
+	}
+	for i := range tn {
+		if tn[i] != bn[i] || tim.Type(tn[i]) != bim.Type(bn[i]) {
+			t.Errorf("'%s' type has inputs %q, block has %q", name, tn, bn)
+			return
+		}
+	}
+}
+
+func randomValue(rnd *rand.Rand, pt block.PortType) interface{} {
+	switch pt {
+	case block.Bool:
+		return rnd.Intn(2) == 0
+	case block.Int:
+		return rnd.Intn(block.HatMax)
+	}
+	return rnd.Float64()*2 - 1
+}
+
+// checkRandom sets random values on all inputs and checks outputs.
+func checkRandom(t *testing.T, h *Harness, rnd *rand.Rand) {
+	name := h.Type.Name()
+	var sels []string
+	var types []block.PortType
+	if im := h.Block.Input(); im != nil {
+		for _, sel := range im.Names() {
+			sels, types = append(sels, sel), append(types, im.Type(sel))
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		for j, sel := range sels {
+			if err := h.Set(sel, randomValue(rnd, types[j])); err != nil {
+				t.Errorf("'%s': %v", name, err)
+				return
+			}
+		}
+		if err := h.Step(1); err != nil {
+			t.Errorf("'%s': %v", name, err)
+			return
+		}
+		om := h.Block.Output()
+		if om == nil {
+			continue
+		}
+		for _, sel := range om.Names() {
+			v, err := h.Output(sel)
+			if err != nil {
+				t.Errorf("'%s': %v", name, err)
+				return
+			}
+			switch x := v.(type) {
+			case float64:
+				if _, ok := unbounded[name]; !ok && (math.IsNaN(x) || math.Abs(x) > 1+1e-9) {
+					t.Errorf("'%s' output '%s' out of range: %v", name, sel, x)
+					return
+				}
+			case int:
+				if x < 0 || x >= block.HatMax {
+					t.Errorf("'%s' output '%s' is an invalid hat: %v", name, sel, x)
+					return
+				}
+			}
+		}
+	}
+}
+
+func checkAllocs(t *testing.T, h *Harness) {
+	ticker, ok := h.Block.(block.Ticker)
+	if !ok {
+		return
+	}
+	if n := testing.AllocsPerRun(100, ticker.Tick); n != 0 {
+		t.Errorf("'%s' Tick allocates: %v", h.Type.Name(), n)
+	}
+}
+
+// truthCase is the expected output of a logic or comparison
+// block for a set of inputs.
+type truthCase struct {
+	typ   string
+	param map[string]interface{}
+	in    []interface{}
+	out   interface{}
+}
+
+var truthTables = []truthCase{
+	{"not", nil, []interface{}{false}, true},
+	{"not", nil, []interface{}{true}, false},
+}
+
+func init() {
+	bools := [][]bool{{false, false}, {false, true}, {true, false}, {true, true}}
+	ops := map[string]func(a, b bool) bool{
+		"and": func(a, b bool) bool { return a && b },
+		"or":  func(a, b bool) bool { return a || b },
+		"xor": func(a, b bool) bool { return a != b },
+	}
+	for typ, f := range ops {
+		for _, v := range bools {
+			truthTables = append(truthTables, truthCase{typ, nil, []interface{}{v[0], v[1]}, f(v[0], v[1])})
+			for _, c := range []bool{false, true} {
+				truthTables = append(truthTables, truthCase{typ, nil, []interface{}{v[0], v[1], c}, f(f(v[0], v[1]), c)})
+			}
+		}
+	}
+
+	nums := []float64{-1, -0.5, -0.4995, 0, 0.0005, 0.5, 1}
+	cmps := map[string]func(a, b float64) bool{
+		"eq":  func(a, b float64) bool { return a == b },
+		"ne":  func(a, b float64) bool { return a != b },
+		"lt":  func(a, b float64) bool { return a < b },
+		"gt":  func(a, b float64) bool { return a > b },
+		"le":  func(a, b float64) bool { return a <= b },
+		"ge":  func(a, b float64) bool { return a >= b },
+		"xeq": func(a, b float64) bool { return math.Abs(a-b) <= 1e-3 },
+		"xne": func(a, b float64) bool { return math.Abs(a-b) > 1e-3 },
+	}
+	for typ, f := range cmps {
+		for _, a := range nums {
+			for _, b := range nums {
+				truthTables = append(truthTables, truthCase{typ, nil, []interface{}{a, b}, f(a, b)})
+			}
+		}
+	}
+	// eq and ne compare buttons and hats too
+	for _, a := range []bool{false, true} {
+		for _, b := range []bool{false, true} {
+			truthTables = append(truthTables,
+				truthCase{"eq", nil, []interface{}{a, b}, a == b},
+				truthCase{"ne", nil, []interface{}{a, b}, a != b})
+		}
+	}
+	for _, a := range []int{block.HatCentre, block.HatNorth, block.HatNorth | block.HatEast} {
+		for _, b := range []int{block.HatCentre, block.HatNorth, block.HatNorth | block.HatEast} {
+			truthTables = append(truthTables,
+				truthCase{"eq", nil, []interface{}{a, b}, a == b},
+				truthCase{"ne", nil, []interface{}{a, b}, a != b})
+		}
+	}
+}
+
+func TestTruthTables(t *testing.T) {
+	for _, tt := range truthTables {
+		h, err := New(tt.typ, tt.param, 1000)
+		if err != nil {
+			t.Errorf("'%s': %v", tt.typ, err)
+			continue
+		}
+		sels := h.Block.Input().Names()
+		for i, v := range tt.in {
+			if err := h.Set(sels[i], v); err != nil {
+				t.Errorf("'%s': %v", tt.typ, err)
+			}
+		}
+		if err := h.Step(1); err != nil {
+			t.Errorf("'%s': %v", tt.typ, err)
+			continue
+		}
+		got, err := h.Output("")
+		if err != nil {
+			t.Errorf("'%s': %v", tt.typ, err)
+			continue
+		}
+		if got != tt.out {
+			t.Errorf("'%s' %v yields %v, want %v", tt.typ, tt.in, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package blocktest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Param is a block.Param backed by a map. Values are float64 or int, string,
+// []float64, or Ident for identifiers. Arguments missing from the map
+// are reported by Err, optional ones return the default for them.
+// Values of the wrong kind, and arguments in the map never read are
+// reported by Err too, so that mistakes in tests don't go unnoticed.
+type Param struct {
+	m        map[string]interface{}
+	tickfreq float64
+	read     map[string]bool
+	err      error
+}
+
+// Ident is an identifier used as a value in a Param.
+type Ident string
+
+// NewParam returns a Param using values in m, and tickfreq ticks per second.
+func NewParam(m map[string]interface{}, tickfreq float64) *Param {
+	return &Param{m: m, tickfreq: tickfreq, read: make(map[string]bool)}
+}
+
+func (p *Param) Arg(n string) float64 { return p.number(n, 0, false) }
+
+func (p *Param) OptArg(n string, d float64) float64 { return p.number(n, d, true) }
+
+func (p *Param) number(n string, d float64, opt bool) float64 {
+	v, ok := p.get(n, opt)
+	if !ok {
+		return d
+	}
+	if x, ok := number(v); ok {
+		return x
+	}
+	p.mismatch(n, "a number", v)
+	return d
+}
+
+// number converts v to float64, so that untyped integer
+// constants can be used in maps of values.
+func number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case int:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+func (p *Param) StrArg(n string) string { return p.str(n, "", false) }
+
+func (p *Param) OptStrArg(n string, d string) string { return p.str(n, d, true) }
+
+func (p *Param) str(n string, d string, opt bool) string {
+	v, ok := p.get(n, opt)
+	if !ok {
+		return d
+	}
+	switch x := v.(type) {
+	case string:
+		return x
+	case Ident:
+		return string(x)
+	}
+	p.mismatch(n, "a string", v)
+	return d
+}
+
+func (p *Param) IdentArg(n string, choices ...string) string {
+	return p.ident(n, "", false, choices)
+}
+
+func (p *Param) OptIdentArg(n string, d string, choices ...string) string {
+	return p.ident(n, d, true, choices)
+}
+
+func (p *Param) ident(n string, d string, opt bool, choices []string) string {
+	v, ok := p.get(n, opt)
+	if !ok {
+		return d
+	}
+	x, ok := v.(Ident)
+	if !ok {
+		p.mismatch(n, "an identifier", v)
+		return d
+	}
+	if len(choices) != 0 && !has(choices, string(x)) {
+		p.seterr(fmt.Errorf("argument '%s': '%s' is not one of %s", n, x, strings.Join(choices, ", ")))
+		return d
+	}
+	return string(x)
+}
+
+func (p *Param) ListArg(n string) []float64 { return p.list(n, nil, false) }
+
+func (p *Param) OptListArg(n string, d []float64) []float64 { return p.list(n, d, true) }
+
+func (p *Param) list(n string, d []float64, opt bool) []float64 {
+	v, ok := p.get(n, opt)
+	if !ok {
+		return d
+	}
+	if x, ok := v.([]float64); ok {
+		return x
+	}
+	if x, ok := number(v); ok {
+		return []float64{x}
+	}
+	p.mismatch(n, "a list of numbers", v)
+	return d
+}
+
+// get returns the value for n, and records an error if it is missing unless opt is true.
+func (p *Param) get(n string, opt bool) (interface{}, bool) {
+	p.read[n] = true
+	v, ok := p.m[n]
+	if !ok && !opt {
+		p.seterr(fmt.Errorf("argument '%s' missing", n))
+	}
+	return v, ok
+}
+
+func (p *Param) mismatch(n, want string, v interface{}) {
+	p.seterr(fmt.Errorf("argument '%s' must be %s, have %T", n, want, v))
+}
+
+func (p *Param) seterr(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *Param) TickFreq() float64 { return p.tickfreq }
+func (p *Param) TickTime() float64 { return 1 / p.tickfreq }
+
+// Err returns the first error encountered, or reports
+// arguments in the map that were not read.
+func (p *Param) Err() error {
+	if p.err != nil {
+		return p.err
+	}
+	var v []string
+	for n := range p.m {
+		if !p.read[n] {
+			v = append(v, n)
+		}
+	}
+	if len(v) != 0 {
+		sort.Strings(v)
+		return fmt.Errorf("unknown argument '%s'", strings.Join(v, "', '"))
+	}
+	return nil
+}
+
+func has(v []string, s string) bool {
+	for _, x := range v {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,5 +1,9 @@
 package block
 
+import (
+	"fmt"
+)
+
 func RegisterCmpFunc(name string, fn func(a, b float64) bool) {
 	Register(name, func() Block {
 		return &cmpopblk{typ: name, tick: fn}
@@ -22,24 +26,156 @@ func (b *cmpopblk) Output() OutputMap { return SingleOutput(b.typ, &b.o) }
 func (b *cmpopblk) Validate() error   { return CheckInputs(b.typ, &b.i1, &b.i2) }
 
 func init() {
-	RegisterCmpFunc("eq", func(a, b float64) bool { return a == b })
-	RegisterCmpFunc("ne", func(a, b float64) bool { return a != b })
+	RegisterType(&eqtype{"eq", true, &TypeDoc{Category: "Simple blocks",
+		Summary: "inputs are equal (see also `xeq`)", Ports: eqports}})
+	RegisterType(&eqtype{"ne", false, &TypeDoc{Category: "Simple blocks",
+		Summary: "inputs differ (see also `xne`)", Ports: eqports}})
 	RegisterCmpFunc("lt", func(a, b float64) bool { return a < b })
 	RegisterCmpFunc("gt", func(a, b float64) bool { return a > b })
 	RegisterCmpFunc("le", func(a, b float64) bool { return a <= b })
 	RegisterCmpFunc("ge", func(a, b float64) bool { return a >= b })
 
+	for name, sum := range map[string]string{
+		"lt": "first input is less than the second",
+		"gt": "first input is greater than the second",
+		"le": "first input is less than or equal to the second",
+		"ge": "first input is greater than or equal to the second",
+	} {
+		Describe(name, &TypeDoc{Category: "Simple blocks", Summary: sum})
+	}
+
 	RegisterParam("xeq", func(p Param) (Block, error) {
 		r := p.OptArg("Range", 1e-3)
 		return &cmpopblk{typ: "xeq", tick: func(a, b float64) bool {
 			return a <= b+r && b <= a+r
 		}}, nil
-	})
+	}, Opt("Range", Axis, 1e-3, 0, 1))
 	RegisterParam("xne", func(p Param) (Block, error) {
 		r := p.OptArg("Range", 1e-3)
 		return &cmpopblk{typ: "xne", tick: func(a, b float64) bool {
-			return a+r < b && b+r < a
+			return a+r < b || b+r < a
 		}}, nil
-	})
+	}, Opt("Range", Axis, 1e-3, 0, 1))
+
+	for name, sum := range map[string]string{
+		"xeq": "inputs are within `Range`",
+		"xne": "inputs differ by more than `Range`",
+	} {
+		Describe(name, &TypeDoc{
+			Category: "Blocks with parameters",
+			Summary:  sum,
+			Text: "Similar to `eq` and `ne`, but uses the `Range` parameter to decide if " +
+				"the values are close enough, rather than using exact comparison that may be " +
+				"inaccurate because of floating point rounding errors.",
+			Params: map[string]string{"Range": "maximum difference of equal values"},
+		})
+	}
+}
+
+var eqports = map[string]string{
+	"1": "any type, must match 2",
+	"2": "any type, must match 1",
+}
+
+// eqtype is the type of eq and ne blocks. Unlike other comparisons,
+// they compare inputs of any type, such as buttons or hats.
+type eqtype struct {
+	name string
+	eq   bool // output is on for equal inputs
+	doc  *TypeDoc
+}
+
+func (t *eqtype) Name() string             { return t.name }
+func (t *eqtype) New(Param) (Block, error) { return &eqblk{typ: t.name, eq: t.eq}, nil }
+func (*eqtype) Verify(Param) error         { return nil }
+func (*eqtype) Params() []ParamSpec        { return nil }
+func (t *eqtype) Doc() *TypeDoc            { return t.doc }
+func (t *eqtype) Input(Param) TypeInputMap { return &eqinput{&eqblk{typ: t.name}} }
+func (t *eqtype) Accept(p Param, in PortTypeMap) (PortTypeMap, error) {
+	a, b := in["1"], in["2"]
+	if a == Invalid || b == Invalid {
+		return nil, fmt.Errorf("'%s' needs valid '1' and '2'", t.name)
+	}
+	if a != b {
+		return nil, fmt.Errorf("'%s' needs inputs of the same type, has %s and %s",
+			t.name, PortTypeName(a), PortTypeName(b))
+	}
+	return PortTypeMap{"": Bool}, nil
+}
+func (*eqtype) MustHaveInput() bool { return true }
+
+type eqblk struct {
+	typ    string
+	eq     bool
+	i1, i2 Port
+	o      bool
+	tick   func()
+}
+
+func (b *eqblk) Tick()             { b.tick() }
+func (b *eqblk) Input() InputMap   { return &eqinput{b} }
+func (b *eqblk) Output() OutputMap { return SingleOutput(b.typ, &b.o) }
+func (b *eqblk) Validate() error {
+	for i, p := range []Port{b.i1, b.i2} {
+		if p == nil {
+			return fmt.Errorf("'%s' input %d: port is nil", b.typ, i+1)
+		}
+	}
+	return nil
+}
+
+type eqinput struct {
+	b *eqblk
+}
+
+func (inp *eqinput) Names() []string { return []string{"1", "2"} }
+
+func (inp *eqinput) Type(sel string) PortType {
+	switch sel {
+	case "1", "2":
+		return Any
+	}
+	panic(fmt.Sprintf("%s block has no input named '%s'", inp.b.typ, sel))
+}
+
+func (inp *eqinput) Value(sel string) interface{} {
+	switch sel {
+	case "1":
+		return pval(inp.b.i1)
+	case "2":
+		return pval(inp.b.i2)
+	}
+	return nil
+}
 
+func (inp *eqinput) Set(sel string, port Port) error {
+	b := inp.b
+	switch sel {
+	case "1":
+		b.i1 = port
+	case "2":
+		b.i2 = port
+	default:
+		return fmt.Errorf("%s block has no input named '%s'", b.typ, sel)
+	}
+	if b.i1 == nil || b.i2 == nil {
+		return nil
+	}
+	if !matchport(b.i1, b.i2) {
+		return fmt.Errorf("%s block inputs must have the same type, has %s and %s", b.typ, PortString(b.i1), PortString(b.i2))
+	}
+	switch x := b.i1.(type) {
+	case *bool:
+		y := b.i2.(*bool)
+		b.tick = func() { b.o = (*x == *y) == b.eq }
+	case *float64:
+		y := b.i2.(*float64)
+		b.tick = func() { b.o = (*x == *y) == b.eq }
+	case *int:
+		y := b.i2.(*int)
+		b.tick = func() { b.o = (*x == *y) == b.eq }
+	default:
+		return fmt.Errorf("'%s' internal error", b.typ)
+	}
+	return nil
 }
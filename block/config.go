@@ -1,5 +1,9 @@
 package block
 
+import (
+	"fmt"
+)
+
 const (
 	DefaultTickFreq     = 1e3 // 1 millisecond
 	defaultTickFreqName = "Update"
@@ -9,20 +13,122 @@ type Param interface {
 	Arg(string) float64
 	OptArg(string, float64) float64
 
+	// strings, identifiers such as the names of curves, and lists of numbers
+	StrArg(string) string
+	OptStrArg(string, string) string
+	IdentArg(n string, choices ...string) string
+	OptIdentArg(n string, def string, choices ...string) string
+	ListArg(string) []float64
+	OptListArg(string, []float64) []float64
+
 	TickFreq() float64 // ticks per seconds: 1e6/float64(c.UpdateMicros)
 	TickTime() float64 // time in seconds elapsed duting one tick: float64(c.UpdateMicros) / 1e6
 }
 
 // ProtoParam represents an empty parameter map used
 // during prototype creation in type checks. Arg() values will are eauql to 0.5,
-// and OptArg() always returns the default. An update frequency of 1e3 is assumed.
-// Block types registered using Register() or RegisterParam() should not
-// return an error when this value is provided.
+// and OptArg() always returns the default. Other required arguments are empty
+// strings, the first of the choices for identifiers and a list of a single 0.5.
+// An update frequency of 1e3 is assumed.
+// Block types registered using Register(), RegisterParam() or
+// RegisterParamPorts() should not return an error when this value is
+// provided. Blocks of types registered using RegisterParamPorts() should
+// have all ports they may have for any parameters.
 var ProtoParam Param = new(protoparam)
 
 type protoparam struct{}
 
-func (*protoparam) Arg(n string) float64               { return 0.5 }
-func (*protoparam) OptArg(n string, d float64) float64 { return d }
-func (*protoparam) TickFreq() float64                  { return DefaultTickFreq }
-func (*protoparam) TickTime() float64                  { return 1 / DefaultTickFreq }
+func (*protoparam) Arg(n string) float64                { return 0.5 }
+func (*protoparam) OptArg(n string, d float64) float64  { return d }
+func (*protoparam) StrArg(n string) string              { return "" }
+func (*protoparam) OptStrArg(n string, d string) string { return d }
+func (*protoparam) ListArg(n string) []float64          { return []float64{0.5} }
+func (*protoparam) TickFreq() float64                   { return DefaultTickFreq }
+func (*protoparam) TickTime() float64                   { return 1 / DefaultTickFreq }
+
+func (*protoparam) IdentArg(n string, choices ...string) string {
+	if len(choices) != 0 {
+		return choices[0]
+	}
+	return ""
+}
+
+func (*protoparam) OptIdentArg(n string, d string, choices ...string) string { return d }
+func (*protoparam) OptListArg(n string, d []float64) []float64               { return d }
+
+// Unit is the unit of a numeric parameter value.
+type Unit int
+
+const (
+	Number     Unit = iota // plain number
+	Axis                   // relative axis value
+	Seconds                // time in seconds
+	PerSecond              // axis value per second
+	Flag                   // boolean flag, nonzero meaning true
+	Identifier             // identifier, one of the choices of the parameter
+)
+
+var unitNames = []string{"number", "axis", "seconds", "per second", "flag", "identifier"}
+
+func (u Unit) String() string {
+	if int(u) < len(unitNames) {
+		return unitNames[u]
+	}
+	return fmt.Sprintf("Unit(%d)", int(u))
+}
+
+// ParamSpec describes a parameter of a block type. Parameters are numeric,
+// except those having Identifier units, which are read using OptIdentArg.
+// The range is checked only if Min and Max are different.
+type ParamSpec struct {
+	Name     string
+	Required bool
+	Default  float64 // value used if the parameter is not required and missing
+	Min, Max float64 // valid range
+	Unit     Unit
+	Choices  []string // identifiers allowed, the first one is the default
+}
+
+// Check reports if v is out of the range of s.
+func (s *ParamSpec) Check(v float64) error {
+	if s.Min != s.Max && (v < s.Min || s.Max < v) {
+		return fmt.Errorf("parameter '%s' out of range (%g..%g, have %g)", s.Name, s.Min, s.Max, v)
+	}
+	return nil
+}
+
+// Req returns the spec of a required parameter.
+func Req(name string, u Unit, min, max float64) ParamSpec {
+	return ParamSpec{Name: name, Required: true, Min: min, Max: max, Unit: u}
+}
+
+// Opt returns the spec of an optional parameter with default value def.
+func Opt(name string, u Unit, def, min, max float64) ParamSpec {
+	return ParamSpec{Name: name, Default: def, Min: min, Max: max, Unit: u}
+}
+
+// Choice returns the spec of an optional identifier parameter,
+// having one of choices as its value, or the first one if missing.
+func Choice(name string, choices ...string) ParamSpec {
+	return ParamSpec{Name: name, Unit: Identifier, Choices: choices}
+}
+
+// checkParam checks numeric arguments read from Param against specs.
+type checkParam struct {
+	Param
+	specs []ParamSpec
+	err   error
+}
+
+func (p *checkParam) Arg(n string) float64 { return p.check(n, p.Param.Arg(n)) }
+
+func (p *checkParam) OptArg(n string, d float64) float64 { return p.check(n, p.Param.OptArg(n, d)) }
+
+func (p *checkParam) check(n string, v float64) float64 {
+	for i := range p.specs {
+		if s := &p.specs[i]; s.Name == n && p.err == nil {
+			p.err = s.Check(v)
+		}
+	}
+	return v
+}
@@ -17,9 +17,14 @@ func DebugOutput(w io.Writer, p *Profile, names ...string) {
 	}
 }
 
+// has reports if s is in v, or is the name of a block within
+// a group (name#...) or def instance (name/...) in v.
 func has(v []string, s string) bool {
 	for _, vv := range v {
-		if vv == s || (len(s) > len(vv) && s[:len(vv)+1] == vv+"#") {
+		if vv == s {
+			return true
+		}
+		if len(s) > len(vv) && s[:len(vv)] == vv && (s[len(vv)] == '#' || s[len(vv)] == '/') {
 			return true
 		}
 	}
@@ -0,0 +1,114 @@
+package block
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterType(new(delaytype))
+}
+
+// Delayer is implemented by Types of delay blocks,
+// see the Delayer interface of package parser.
+type Delayer interface {
+	Delayed() bool
+}
+
+// delaytype is the type of delay blocks. The type of their ports is set
+// using a parameter, so that it is known without following links in loops.
+type delaytype struct{}
+
+var delaydoc = &TypeDoc{
+	Category: "Blocks with state",
+	Summary:  "value of input in the previous tick",
+	Text: "`delay` outputs the value its input had in the previous tick, and the zero value " +
+		"(`0`, `off` or `centre`) in the first one. Links may form loops only through " +
+		"`delay` blocks, so that latches, accumulators or controllers can be built from " +
+		"other blocks. The type of the input and output is set using the `Type` parameter.",
+	Params: map[string]string{
+		"Type": "type of the input and output",
+	},
+	Example: "# latch: output.1 is on after input.a is pressed, until input.b is pressed\n" +
+		"block input [gamepad]\n" +
+		"block output [vjoy]\n" +
+		"block latch [or input.a [and prev [not input.b]]]\n" +
+		"block prev [delay latch: bool]\n" +
+		"conn output.1 latch",
+}
+
+func (*delaytype) Name() string        { return "delay" }
+func (*delaytype) Params() []ParamSpec { return delayparams }
+func (*delaytype) Doc() *TypeDoc       { return delaydoc }
+func (*delaytype) Delayed() bool       { return true }
+
+func (*delaytype) New(p Param) (Block, error) { return newdelay(delayPortType(p)), nil }
+
+func (t *delaytype) Verify(p Param) error {
+	_, err := t.New(p)
+	return err
+}
+
+func (*delaytype) Input(p Param) TypeInputMap { return newdelay(delayPortType(p)).Input() }
+
+func (*delaytype) Accept(p Param, in PortTypeMap) (PortTypeMap, error) {
+	pt := delayPortType(p)
+	for n, t := range in {
+		if n != "" {
+			return nil, fmt.Errorf("'delay' has no input '%s'", n)
+		}
+		if t != pt {
+			return nil, fmt.Errorf("'delay' of type %s needs %s input", PortTypeName(pt), PortTypeName(pt))
+		}
+	}
+	return PortTypeMap{"": pt}, nil
+}
+
+var delayparams = []ParamSpec{Choice("Type", "axis", "bool", "hat")}
+
+// delayPortType returns the port type of delays created using p.
+// A nil p is handled like ProtoParam.
+func delayPortType(p Param) PortType {
+	if p == nil {
+		p = ProtoParam
+	}
+	s := delayparams[0]
+	switch p.OptIdentArg(s.Name, s.Choices[0], s.Choices...) {
+	case "bool":
+		return Bool
+	case "hat":
+		return Int
+	}
+	return Float64
+}
+
+type delayblk struct {
+	i    interface{} // pointer to the input port
+	o    Port
+	tick func()
+}
+
+func newdelay(pt PortType) *delayblk {
+	b := new(delayblk)
+	switch pt {
+	case Bool:
+		var i *bool
+		o := new(bool)
+		b.i, b.o, b.tick = &i, o, func() { *o = *i }
+	case Int:
+		var i *int
+		o := new(int)
+		b.i, b.o, b.tick = &i, o, func() { *o = *i }
+	default:
+		var i *float64
+		o := new(float64)
+		b.i, b.o, b.tick = &i, o, func() { *o = *i }
+	}
+	return b
+}
+
+// Tick copies the input to the output. It is called before the block
+// providing the input is ticked, so the value is that of the previous tick.
+func (b *delayblk) Tick()             { b.tick() }
+func (b *delayblk) Input() InputMap   { return SingleInput("delay", b.i) }
+func (b *delayblk) Output() OutputMap { return SingleOutput("delay", b.o) }
+func (b *delayblk) Validate() error   { return CheckInputs("delay", b.i) }
@@ -0,0 +1,26 @@
+package device
+
+import (
+	"fmt"
+
+	vj "github.com/tajtiattila/vjoy"
+)
+
+func init() {
+	Default = winBackend{}
+}
+
+// winBackend uses XInput for gamepads and vJoy for joysticks.
+type winBackend struct{}
+
+func (winBackend) OpenGamepad(dev int) (Gamepad, error)   { return openxinput(dev) }
+func (winBackend) OpenJoystick(dev int) (Joystick, error) { return openvjoy(dev) }
+
+func (winBackend) Info() []string {
+	return []string{
+		fmt.Sprint("vJoy version: ", vj.Version()),
+		fmt.Sprint("  Product:       ", vj.ProductString()),
+		fmt.Sprint("  Manufacturer:  ", vj.ManufacturerString()),
+		fmt.Sprint("  Serial number: ", vj.SerialNumberString()),
+	}
+}
@@ -0,0 +1,91 @@
+// Package device provides the hardware independent interface used
+// by the gamepad and vjoy blocks.
+//
+// Blocks open devices through Default. On Windows it is set up to use
+// XInput gamepads and vJoy devices, elsewhere it is an in-memory Fake.
+package device
+
+import (
+	"github.com/tajtiattila/joyster/block"
+)
+
+const (
+	NumGamepads = 4  // number of XInput gamepads
+	NumAxes     = 8  // number of joystick axes
+	NumButtons  = 32 // number of joystick buttons
+	NumHats     = 4  // number of joystick hats
+)
+
+// GamepadState is the state of an XBOX compatible gamepad.
+// Axes are in the range -1..1, triggers in the range 0..1.
+// Dpad uses the hat bitmask of the block package.
+type GamepadState struct {
+	A, B, X, Y         bool
+	Start, Back        bool
+	LBumper, RBumper   bool
+	LThumb, RThumb     bool
+	LTrigger, RTrigger bool
+
+	LX, LY float64
+	RX, RY float64
+	LT, RT float64
+
+	Dpad int
+}
+
+// Ports returns the fields of s named after the outputs of gamepad blocks.
+func (s *GamepadState) Ports() []block.MapDecl {
+	return []block.MapDecl{
+		{"a", &s.A},
+		{"b", &s.B},
+		{"x", &s.X},
+		{"y", &s.Y},
+		{"start", &s.Start},
+		{"back", &s.Back},
+		{"ltrigger", &s.LTrigger},
+		{"rtrigger", &s.RTrigger},
+		{"lbumper", &s.LBumper},
+		{"rbumper", &s.RBumper},
+		{"lthumb", &s.LThumb},
+		{"rthumb", &s.RThumb},
+		{"lx", &s.LX},
+		{"ly", &s.LY},
+		{"rx", &s.RX},
+		{"ry", &s.RY},
+		{"lt", &s.LT},
+		{"rt", &s.RT},
+		{"dpad", &s.Dpad},
+	}
+}
+
+// Gamepad is an input device.
+type Gamepad interface {
+	// Read updates s with the current state of the gamepad.
+	// It may leave s untouched if the state did not change.
+	Read(s *GamepadState) error
+
+	Close() error
+}
+
+// Joystick is a virtual output device. Values set are
+// sent to the device upon Update.
+type Joystick interface {
+	SetAxis(i int, v float64) // i < NumAxes, -1 <= v <= 1
+	SetButton(i int, v bool)  // i < NumButtons
+	SetHat(i int, v int)      // i < NumHats, v is a hat bitmask
+
+	Update() error
+	Close() error
+}
+
+// Backend opens gamepads and joysticks.
+type Backend interface {
+	OpenGamepad(dev int) (Gamepad, error)
+	OpenJoystick(dev int) (Joystick, error)
+
+	// Info returns human readable information about the backend.
+	Info() []string
+}
+
+// Default is the Backend used by blocks to open devices.
+var Default Backend = NewFake()
@@ -0,0 +1,113 @@
+package device
+
+import (
+	"fmt"
+)
+
+// Fake is an in-memory Backend. Gamepad states can be set and
+// Joystick outputs inspected using FakeGamepad and FakeJoystick.
+type Fake struct {
+	pads map[int]*FakeGamepad
+	joys map[int]*FakeJoystick
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		pads: make(map[int]*FakeGamepad),
+		joys: make(map[int]*FakeJoystick),
+	}
+}
+
+// Gamepad returns the fake gamepad for dev, creating it if necessary.
+func (f *Fake) Gamepad(dev int) *FakeGamepad {
+	g, ok := f.pads[dev]
+	if !ok {
+		g = new(FakeGamepad)
+		f.pads[dev] = g
+	}
+	return g
+}
+
+// Joystick returns the fake joystick for dev, creating it if necessary.
+func (f *Fake) Joystick(dev int) *FakeJoystick {
+	j, ok := f.joys[dev]
+	if !ok {
+		j = new(FakeJoystick)
+		f.joys[dev] = j
+	}
+	return j
+}
+
+func (f *Fake) OpenGamepad(dev int) (Gamepad, error) {
+	if dev < 0 {
+		return nil, fmt.Errorf("invalid gamepad device %d", dev)
+	}
+	g := f.Gamepad(dev)
+	g.Open++
+	return g, nil
+}
+
+func (f *Fake) OpenJoystick(dev int) (Joystick, error) {
+	if dev < 0 {
+		return nil, fmt.Errorf("invalid joystick device %d", dev)
+	}
+	j := f.Joystick(dev)
+	j.Open++
+	return j, nil
+}
+
+func (f *Fake) Info() []string {
+	return []string{"fake devices"}
+}
+
+// FakeGamepad reports State upon Read.
+type FakeGamepad struct {
+	State GamepadState
+	Open  int // open count
+}
+
+func (g *FakeGamepad) Read(s *GamepadState) error {
+	*s = g.State
+	return nil
+}
+
+func (g *FakeGamepad) Close() error {
+	if g.Open == 0 {
+		return fmt.Errorf("fake gamepad not open")
+	}
+	g.Open--
+	return nil
+}
+
+// FakeJoystick records values sent to it. The exported
+// values are updated upon Update.
+type FakeJoystick struct {
+	Axes    [NumAxes]float64
+	Buttons [NumButtons]bool
+	Hats    [NumHats]int
+
+	Updates int // number of Update calls
+	Open    int // open count
+
+	axes    [NumAxes]float64
+	buttons [NumButtons]bool
+	hats    [NumHats]int
+}
+
+func (j *FakeJoystick) SetAxis(i int, v float64) { j.axes[i] = v }
+func (j *FakeJoystick) SetButton(i int, v bool)  { j.buttons[i] = v }
+func (j *FakeJoystick) SetHat(i int, v int)      { j.hats[i] = v }
+
+func (j *FakeJoystick) Update() error {
+	j.Axes, j.Buttons, j.Hats = j.axes, j.buttons, j.hats
+	j.Updates++
+	return nil
+}
+
+func (j *FakeJoystick) Close() error {
+	if j.Open == 0 {
+		return fmt.Errorf("fake joystick not open")
+	}
+	j.Open--
+	return nil
+}
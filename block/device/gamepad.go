@@ -0,0 +1,38 @@
+package device
+
+import (
+	"github.com/tajtiattila/joyster/block"
+)
+
+// NewGamepadBlock returns a block named typ that reads g upon each tick.
+// Its outputs are named after the ports of GamepadState.
+// If g is nil, the block is a prototype having zero outputs.
+func NewGamepadBlock(typ string, g Gamepad) block.Block {
+	return &gamepad{typ: typ, dev: g}
+}
+
+type gamepad struct {
+	typ string
+	dev Gamepad
+	s   GamepadState
+}
+
+func (p *gamepad) Input() block.InputMap { return nil }
+func (p *gamepad) Validate() error       { return nil }
+
+func (p *gamepad) Output() block.OutputMap {
+	return block.MapOutput(p.typ, p.s.Ports()...)
+}
+
+func (p *gamepad) Tick() {
+	if p.dev != nil {
+		p.dev.Read(&p.s)
+	}
+}
+
+func (p *gamepad) Close() error {
+	if p.dev != nil {
+		return p.dev.Close()
+	}
+	return nil
+}
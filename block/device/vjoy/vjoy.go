@@ -3,7 +3,7 @@ package vjoy
 import (
 	"fmt"
 	"github.com/tajtiattila/joyster/block"
-	vj "github.com/tajtiattila/vjoy"
+	"github.com/tajtiattila/joyster/block/device"
 )
 
 func init() {
@@ -12,105 +12,47 @@ func init() {
 			return new(vjoyproto), nil
 		}
 		return newVjoyBlock(int(p.OptArg("Device", 1)))
+	}, block.Opt("Device", block.Number, 1, 1, 16))
+	block.Describe("vjoy", &block.TypeDoc{
+		Category: "Device blocks",
+		Summary:  "vJoy output",
+		Text: "`vjoy` creates a [vJoy] output block.\n\n" +
+			"The `vjoy` block supports 4-way discrete hats only, so only one of the input components " +
+			"will be used. Inputs representing diagonals will yield their vertical (north or south) component.",
+		Params: map[string]string{"Device": "vJoy device to use, 1 is the first one"},
 	})
 }
 
-type devnode struct {
-	device   *vj.Device
-	usecount int
-}
-
-var devices []devnode
-
-func openvjoy(idev int) (*vj.Device, error) {
-	if idev < len(devices) {
-		node := &devices[idev]
-		if node.device != nil {
-			node.usecount++
-			return node.device, nil
-		}
-	}
-	dev, err := vj.Acquire(uint(idev))
-	if err != nil {
-		return nil, err
-	}
-	if len(devices) <= idev {
-		n := make([]devnode, idev+1, 3*idev+1)
-		copy(n, devices)
-		devices = n
-	}
-	devices[idev] = devnode{dev, 1}
-	return dev, nil
-}
-
-func closevjoy(idev int) error {
-	if idev < len(devices) {
-		node := &devices[idev]
-		if node.usecount != 0 && node.device != nil {
-			node.usecount--
-			if node.usecount == 0 {
-				node.device.Relinquish()
-				node.device = nil
-			}
-			return nil
-		}
-	}
-	return fmt.Errorf("device %d not open", idev)
-}
-
 var axes = []string{"x", "y", "z", "rx", "ry", "rz", "u", "v"}
 
 type vjoyblk struct {
-	idev int
-	dev  *vj.Device
-
-	axes    []*axis
-	buttons []*btn
-	hats    []*hat
-}
+	dev device.Joystick
 
-type axis struct {
-	v *float64
-	p *vj.Axis
-}
-
-type hat struct {
-	v *int
-	p vj.Hat
-}
-
-type btn struct {
-	v *bool
-	p *vj.Button
+	axes    []*float64
+	buttons []*bool
+	hats    []*int
 }
 
 func newVjoyBlock(idev int) (block.Block, error) {
-	d, err := openvjoy(idev)
+	d, err := device.Default.OpenJoystick(idev)
 	if err != nil {
 		return nil, err
 	}
-	blk := &vjoyblk{idev: idev, dev: d}
+	blk := &vjoyblk{dev: d}
 
 	zero := new(float64)
-	blk.axes = []*axis{
-		{zero, d.Axis(vj.AxisX)},
-		{zero, d.Axis(vj.AxisY)},
-		{zero, d.Axis(vj.AxisZ)},
-		{zero, d.Axis(vj.AxisRX)},
-		{zero, d.Axis(vj.AxisRY)},
-		{zero, d.Axis(vj.AxisRZ)},
-		{zero, d.Axis(vj.Slider0)},
-		{zero, d.Axis(vj.Slider1)},
+	for i := 0; i < device.NumAxes; i++ {
+		blk.axes = append(blk.axes, zero)
 	}
 
 	off := new(bool)
-	for i := 0; i < 32; i++ {
-		blk.buttons = append(blk.buttons, &btn{off, d.Button(uint(i))})
+	for i := 0; i < device.NumButtons; i++ {
+		blk.buttons = append(blk.buttons, off)
 	}
 
 	centre := new(int)
-	for i := 0; i < 4; i++ {
-		blk.hats = append(blk.hats, &hat{centre, d.Hat(i)})
+	for i := 0; i < device.NumHats; i++ {
+		blk.hats = append(blk.hats, centre)
 	}
 
 	return blk, nil
@@ -118,14 +60,14 @@ func newVjoyBlock(idev int) (block.Block, error) {
 
 func (v *vjoyblk) Input() block.InputMap {
 	var decl []block.MapDecl
-	for i, a := range v.axes {
-		decl = append(decl, pt(axes[i], &a.v))
+	for i := range v.axes {
+		decl = append(decl, pt(axes[i], &v.axes[i]))
 	}
-	for i, h := range v.hats {
-		decl = append(decl, pt(fmt.Sprint("hat", i+1), &h.v))
+	for i := range v.hats {
+		decl = append(decl, pt(fmt.Sprint("hat", i+1), &v.hats[i]))
 	}
-	for i, b := range v.buttons {
-		decl = append(decl, pt(fmt.Sprint(i+1), &b.v))
+	for i := range v.buttons {
+		decl = append(decl, pt(fmt.Sprint(i+1), &v.buttons[i]))
 	}
 	return block.MapInput("vjoy", decl...)
 }
@@ -133,18 +75,18 @@ func (v *vjoyblk) Input() block.InputMap {
 func (v *vjoyblk) Output() block.OutputMap { return nil }
 func (v *vjoyblk) Validate() error         { return nil }
 func (v *vjoyblk) Close() error {
-	return closevjoy(v.idev)
+	return v.dev.Close()
 }
 
 func (v *vjoyblk) Tick() {
-	for _, a := range v.axes {
-		a.p.Setf(float32(*a.v))
+	for i, a := range v.axes {
+		v.dev.SetAxis(i, *a)
 	}
-	for _, h := range v.hats {
-		h.p.SetDiscrete(hatmap[*h.v&block.HatMask])
+	for i, h := range v.hats {
+		v.dev.SetHat(i, *h)
 	}
-	for _, b := range v.buttons {
-		b.p.Set(*b.v)
+	for i, b := range v.buttons {
+		v.dev.SetButton(i, *b)
 	}
 	v.dev.Update()
 }
@@ -159,35 +101,13 @@ func (v *vjoyproto) Input() block.InputMap {
 	for _, n := range axes {
 		decl = append(decl, pt(n, &fp))
 	}
-	for i := 0; i < 4; i++ {
+	for i := 0; i < device.NumHats; i++ {
 		decl = append(decl, pt(fmt.Sprint("hat", i+1), &hp))
 	}
-	for i := 0; i < 32; i++ {
+	for i := 0; i < device.NumButtons; i++ {
 		decl = append(decl, pt(fmt.Sprint(i+1), &bp))
 	}
 	return block.MapInput("vjoyproto", decl...)
 }
 
-var hatmap []vj.HatState
-
-func init() {
-	hatmap = make([]vj.HatState, block.HatMax)
-	for i := 0; i < block.HatMax; i++ {
-		var hs vj.HatState
-		switch {
-		case (i & block.HatNorth) != 0:
-			hs = vj.HatN
-		case (i & block.HatSouth) != 0:
-			hs = vj.HatS
-		case (i & block.HatEast) != 0:
-			hs = vj.HatE
-		case (i & block.HatWest) != 0:
-			hs = vj.HatW
-		default:
-			hs = vj.HatOff
-		}
-		hatmap[i] = hs
-	}
-}
-
 func pt(n string, v interface{}) block.MapDecl { return block.MapDecl{n, v} }
@@ -0,0 +1,123 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/tajtiattila/joyster/block"
+	vj "github.com/tajtiattila/vjoy"
+)
+
+type devnode struct {
+	device   *vj.Device
+	usecount int
+}
+
+var devices []devnode
+
+func acquirevjoy(idev int) (*vj.Device, error) {
+	if idev < len(devices) {
+		node := &devices[idev]
+		if node.device != nil {
+			node.usecount++
+			return node.device, nil
+		}
+	}
+	dev, err := vj.Acquire(uint(idev))
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) <= idev {
+		n := make([]devnode, idev+1, 3*idev+1)
+		copy(n, devices)
+		devices = n
+	}
+	devices[idev] = devnode{dev, 1}
+	return dev, nil
+}
+
+func relinquishvjoy(idev int) error {
+	if idev < len(devices) {
+		node := &devices[idev]
+		if node.usecount != 0 && node.device != nil {
+			node.usecount--
+			if node.usecount == 0 {
+				node.device.Relinquish()
+				node.device = nil
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("device %d not open", idev)
+}
+
+type vjoystick struct {
+	idev int
+	dev  *vj.Device
+
+	axes    []*vj.Axis
+	buttons []*vj.Button
+	hats    []vj.Hat
+}
+
+func openvjoy(idev int) (Joystick, error) {
+	if idev < 0 {
+		return nil, fmt.Errorf("invalid vJoy device %d", idev)
+	}
+	d, err := acquirevjoy(idev)
+	if err != nil {
+		return nil, err
+	}
+	j := &vjoystick{idev: idev, dev: d}
+	j.axes = []*vj.Axis{
+		d.Axis(vj.AxisX),
+		d.Axis(vj.AxisY),
+		d.Axis(vj.AxisZ),
+		d.Axis(vj.AxisRX),
+		d.Axis(vj.AxisRY),
+		d.Axis(vj.AxisRZ),
+		d.Axis(vj.Slider0),
+		d.Axis(vj.Slider1),
+	}
+	for i := 0; i < NumButtons; i++ {
+		j.buttons = append(j.buttons, d.Button(uint(i)))
+	}
+	for i := 0; i < NumHats; i++ {
+		j.hats = append(j.hats, d.Hat(i))
+	}
+	return j, nil
+}
+
+func (j *vjoystick) SetAxis(i int, v float64) { j.axes[i].Setf(float32(v)) }
+func (j *vjoystick) SetButton(i int, v bool)  { j.buttons[i].Set(v) }
+func (j *vjoystick) SetHat(i int, v int)      { j.hats[i].SetDiscrete(hatmap[v&block.HatMask]) }
+
+func (j *vjoystick) Update() error {
+	j.dev.Update()
+	return nil
+}
+
+func (j *vjoystick) Close() error {
+	return relinquishvjoy(j.idev)
+}
+
+var hatmap []vj.HatState
+
+func init() {
+	hatmap = make([]vj.HatState, block.HatMax)
+	for i := 0; i < block.HatMax; i++ {
+		var hs vj.HatState
+		switch {
+		case (i & block.HatNorth) != 0:
+			hs = vj.HatN
+		case (i & block.HatSouth) != 0:
+			hs = vj.HatS
+		case (i & block.HatEast) != 0:
+			hs = vj.HatE
+		case (i & block.HatWest) != 0:
+			hs = vj.HatW
+		default:
+			hs = vj.HatOff
+		}
+		hatmap[i] = hs
+	}
+}
@@ -0,0 +1,95 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/tajtiattila/joyster/block"
+	xi "github.com/tajtiattila/xinput"
+)
+
+type xinputpad struct {
+	dev uint
+	xs  xi.State
+}
+
+func openxinput(dev int) (Gamepad, error) {
+	if dev < 0 {
+		return nil, fmt.Errorf("invalid gamepad device %d", dev)
+	}
+	return &xinputpad{dev: uint(dev)}, nil
+}
+
+func (p *xinputpad) Close() error { return nil }
+
+func (p *xinputpad) Read(s *GamepadState) error {
+	last := p.xs.PacketNumber
+	xi.GetState(p.dev, &p.xs)
+	if last == p.xs.PacketNumber {
+		return nil // state unchanged
+	}
+
+	xpad := &p.xs.Gamepad
+
+	s.A = (xpad.Buttons & xi.BUTTON_A) != 0
+	s.B = (xpad.Buttons & xi.BUTTON_B) != 0
+	s.X = (xpad.Buttons & xi.BUTTON_X) != 0
+	s.Y = (xpad.Buttons & xi.BUTTON_Y) != 0
+
+	s.Start = (xpad.Buttons & xi.START) != 0
+	s.Back = (xpad.Buttons & xi.BACK) != 0
+
+	s.LBumper = (xpad.Buttons & xi.LEFT_SHOULDER) != 0
+	s.RBumper = (xpad.Buttons & xi.RIGHT_SHOULDER) != 0
+
+	s.LThumb = (xpad.Buttons & xi.LEFT_THUMB) != 0
+	s.RThumb = (xpad.Buttons & xi.RIGHT_THUMB) != 0
+
+	s.LTrigger = xpad.LeftTrigger != 0
+	s.RTrigger = xpad.RightTrigger != 0
+
+	d := int(xpad.Buttons & (xi.DPAD_UP | xi.DPAD_DOWN | xi.DPAD_LEFT | xi.DPAD_RIGHT))
+	s.Dpad = dpadmap[d]
+
+	s.LT = uint8scalar(xpad.LeftTrigger)
+	s.RT = uint8scalar(xpad.RightTrigger)
+
+	s.LX = int16scalar(xpad.ThumbLX)
+	s.LY = int16scalar(xpad.ThumbLY)
+	s.RX = int16scalar(xpad.ThumbRX)
+	s.RY = int16scalar(xpad.ThumbRY)
+	return nil
+}
+
+func uint8scalar(v uint8) float64 {
+	return float64(v) / 255
+}
+
+func int16scalar(v int16) float64 {
+	if v < 0 {
+		return float64(v) / 0x8000
+	}
+	return float64(v) / 0x7fff
+}
+
+var dpadmap []int
+
+func init() {
+	dpadmap = make([]int, 16)
+	for i := 0; i < 16; i++ {
+		b := uint16(i)
+		v := 0
+		if (b & xi.DPAD_UP) != 0 {
+			v += block.HatNorth
+		}
+		if (b & xi.DPAD_DOWN) != 0 {
+			v += block.HatSouth
+		}
+		if (b & xi.DPAD_RIGHT) != 0 {
+			v += block.HatEast
+		}
+		if (b & xi.DPAD_LEFT) != 0 {
+			v += block.HatWest
+		}
+		dpadmap[i] = v
+	}
+}
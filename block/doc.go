@@ -0,0 +1,181 @@
+package block
+
+import (
+	"fmt"
+	gosort "sort"
+	"strconv"
+)
+
+// TypeDoc documents a block type.
+type TypeDoc struct {
+	Category string            // name of one of Categories
+	Summary  string            // one line description
+	Text     string            // longer description in markdown, may be empty
+	Ports    map[string]string // descriptions of inputs and outputs
+	Params   map[string]string // descriptions of parameters
+	Example  string            // config lines using the type, may be empty
+}
+
+// Category is a group of related block types.
+type Category struct {
+	Name string
+	Text string // introduction in markdown
+}
+
+// Categories lists the categories of types in the order they are presented.
+var Categories = []Category{
+	{"Device blocks", "Device blocks typically have only either inputs or outputs."},
+	{"Simple blocks", "Simple blocks have only input and output, but no parameters. Their " +
+		"output depends only on the current value of their input. Blocks " +
+		"having numbered inputs accept at least two of them."},
+	{"Blocks with parameters", ""},
+	{"Blocks with state", "Blocks with state output values based on an internal state, which " +
+		"may be adjusted with input."},
+	{"Special blocks", ""},
+	{"Stick filters", "Stick filters have exactly two inputs and two outputs. Both inputs and outputs " +
+		"are named `x` and `y`. A stick filter operates on their values as if they were vectors."},
+	{"Axis filters", ""},
+}
+
+// Documented is implemented by Types carrying documentation.
+type Documented interface {
+	Doc() *TypeDoc
+}
+
+// Describe sets the documentation of the Proto registered as name.
+func Describe(name string, d *TypeDoc) {
+	t, ok := DefaultTypeMap[name].(*Proto)
+	if !ok {
+		panic("Describe: no Proto named " + name)
+	}
+	t.Description = d
+}
+
+// DocOf returns the documentation of t, or an empty
+// TypeDoc if t has none.
+func DocOf(t Type) *TypeDoc {
+	if x, ok := t.(Documented); ok {
+		if d := x.Doc(); d != nil {
+			return d
+		}
+	}
+	return new(TypeDoc)
+}
+
+// PortInfo is an input or output of a type.
+type PortInfo struct {
+	Name string
+	Type PortType
+}
+
+// TypeInfo describes a type using its documentation, ports and parameters.
+type TypeInfo struct {
+	Name    string
+	Doc     *TypeDoc
+	Inputs  []PortInfo
+	Outputs []PortInfo
+	Params  []ParamSpec
+}
+
+// Info returns the description of t. Outputs are those reported by
+// Accept for all inputs set. Inputs of any type are tried both as
+// axis and bool values, outputs following them are reported as any.
+func Info(t Type) (*TypeInfo, error) {
+	ti := &TypeInfo{Name: t.Name(), Doc: DocOf(t), Params: t.Params()}
+	am, bm := make(PortTypeMap), make(PortTypeMap)
+	if tim := t.Input(nil); tim != nil {
+		for _, n := range tim.Names() {
+			pt := tim.Type(n)
+			ti.Inputs = append(ti.Inputs, PortInfo{n, pt})
+			am[n], bm[n] = pt, pt
+			if pt == Any {
+				am[n], bm[n] = Float64, Bool
+			}
+		}
+	}
+	om, err := t.Accept(nil, am)
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %v", t.Name(), err)
+	}
+	obm, err := t.Accept(nil, bm)
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %v", t.Name(), err)
+	}
+	for _, n := range OutputNames(t, nil) {
+		pt := om[n]
+		if obm[n] != pt {
+			pt = Any
+		}
+		ti.Outputs = append(ti.Outputs, PortInfo{n, pt})
+	}
+	return ti, nil
+}
+
+// OutputNames returns the names of the outputs of blocks of type t created
+// using p, in the order of their OutputMap if t is a Proto. Otherwise names
+// are those reported by Accept for all inputs set, with inputs of any type
+// set as axis values, and they are sorted. A nil p is handled like ProtoParam.
+func OutputNames(t Type, p Param) []string {
+	if pt, ok := t.(*Proto); ok {
+		blk := pt.proto(p)
+		defer closeblk(blk)
+		if o := blk.Output(); o != nil {
+			return o.Names()
+		}
+		return nil
+	}
+	am := make(PortTypeMap)
+	if tim := t.Input(p); tim != nil {
+		for _, n := range tim.Names() {
+			am[n] = tim.Type(n)
+			if am[n] == Any {
+				am[n] = Float64
+			}
+		}
+	}
+	om, err := t.Accept(p, am)
+	if err != nil {
+		return nil
+	}
+	var v []string
+	for n := range om {
+		v = append(v, n)
+	}
+	gosort.Sort(portNameSlice(v))
+	return v
+}
+
+func closeblk(blk Block) {
+	if c, ok := blk.(Closer); ok {
+		c.Close()
+	}
+}
+
+// portNameSlice sorts unnamed ports first, and numbered ports in numeric order.
+type portNameSlice []string
+
+func (s portNameSlice) Len() int      { return len(s) }
+func (s portNameSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s portNameSlice) Less(i, j int) bool {
+	a, aerr := strconv.Atoi(s[i])
+	b, berr := strconv.Atoi(s[j])
+	if aerr == nil && berr == nil {
+		return a < b
+	}
+	return s[i] < s[j]
+}
+
+// PortTypeName returns the name of pt used in documentation.
+func PortTypeName(pt PortType) string {
+	switch pt {
+	case Bool:
+		return "bool"
+	case Float64:
+		return "axis"
+	case Int:
+		return "hat"
+	case Any:
+		return "any"
+	}
+	return "invalid"
+}
@@ -9,13 +9,7 @@ func newParserTypeMap(tm TypeMap) parser.TypeMap {
 	ptm := make(parserTypeMap)
 	for _, t := range tm {
 		pt := &parserType{name: t.Name(), typ: t}
-		im := t.Input()
-		if im != nil {
-			pt.inames = im.Names()
-			for _, n := range im.Names() {
-				pt.im = append(pt.im, parser.Port{n, parser.PortType(im.Type(n))})
-			}
-		}
+		pt.im = portMap(t.Input(nil))
 		ptm[t.Name()] = pt
 	}
 	return ptm
@@ -30,22 +24,43 @@ func (pm parserTypeMap) GetType(n string) (parser.Type, error) {
 	return nil, fmt.Errorf("unknown type '%s'", n)
 }
 
+func (pm parserTypeMap) TypeNames() []string {
+	v := make([]string, 0, len(pm))
+	for n := range pm {
+		v = append(v, n)
+	}
+	return v
+}
+
+func portMap(im TypeInputMap) parser.PortMap {
+	var pm parser.PortMap
+	if im != nil {
+		for _, n := range im.Names() {
+			pm = append(pm, parser.Port{n, parser.PortType(im.Type(n))})
+		}
+	}
+	return pm
+}
+
 type parserType struct {
-	name   string
-	typ    Type
-	inames []string
-	im     parser.PortMap
-	om     map[uint64]parser.PortMap
+	name string
+	typ  Type
+	im   parser.PortMap // inputs for ProtoParam
 }
 
-func (t *parserType) Input() parser.PortMap { return t.im }
+func (t *parserType) Input(p parser.Param, globals parser.NamedParam) parser.PortMap {
+	if p == nil {
+		return t.im
+	}
+	return portMap(t.typ.Input(t.param(p, globals)))
+}
 
-func (t *parserType) Output(forinput parser.PortMap) (om parser.PortMap, err error) {
+func (t *parserType) Output(p parser.Param, globals parser.NamedParam, forinput parser.PortMap) (om parser.PortMap, err error) {
 	im := make(PortTypeMap)
 	for _, p := range forinput {
 		im[p.Name] = PortType(p.Type)
 	}
-	bom, err := t.typ.Accept(im)
+	bom, err := t.typ.Accept(t.param(p, globals), im)
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +70,15 @@ func (t *parserType) Output(forinput parser.PortMap) (om parser.PortMap, err err
 	return
 }
 
+// param returns the parameters p for t, or nil if p is nil.
+// Errors in p are reported by Param.
+func (t *parserType) param(p parser.Param, globals parser.NamedParam) Param {
+	if p == nil {
+		return nil
+	}
+	return &parseParam{parser.NewParamReader(p, globals)}
+}
+
 func (t *parserType) Param(p parser.Param, globals parser.NamedParam) error {
 	pp := &parseParam{parser.NewParamReader(p, globals)}
 	err := t.typ.Verify(pp)
@@ -64,12 +88,45 @@ func (t *parserType) Param(p parser.Param, globals parser.NamedParam) error {
 	return pp.Err()
 }
 
+func (t *parserType) ParamNames() []string {
+	var v []string
+	for _, s := range t.typ.Params() {
+		v = append(v, s.Name)
+	}
+	return v
+}
+
+func (t *parserType) OutputNames(p parser.Param, globals parser.NamedParam) []string {
+	return OutputNames(t.typ, t.param(p, globals))
+}
+
+// Stateful reports if blocks of t may have state. All blocks are Tickers,
+// only simple blocks are known to depend just on their current input.
+func (t *parserType) Stateful() bool {
+	return DocOf(t.typ).Category != "Simple blocks"
+}
+
+func (t *parserType) Delayed() bool {
+	d, ok := t.typ.(Delayer)
+	return ok && d.Delayed()
+}
+
 type parseParam struct {
 	r parser.ParamReader
 }
 
-func (p *parseParam) Arg(n string) float64               { return p.r.Arg(n) }
-func (p *parseParam) OptArg(n string, d float64) float64 { return p.r.OptArg(n, d) }
-func (p *parseParam) TickFreq() float64                  { return p.r.OptArg(defaultTickFreqName, DefaultTickFreq) }
-func (p *parseParam) TickTime() float64                  { return 1 / p.TickFreq() }
-func (p *parseParam) Err() error                         { return p.r.Err() }
+func (p *parseParam) Arg(n string) float64                { return p.r.Arg(n) }
+func (p *parseParam) OptArg(n string, d float64) float64  { return p.r.OptArg(n, d) }
+func (p *parseParam) StrArg(n string) string              { return p.r.StrArg(n) }
+func (p *parseParam) OptStrArg(n string, d string) string { return p.r.OptStrArg(n, d) }
+func (p *parseParam) IdentArg(n string, c ...string) string {
+	return p.r.IdentArg(n, c...)
+}
+func (p *parseParam) OptIdentArg(n string, d string, c ...string) string {
+	return p.r.OptIdentArg(n, d, c...)
+}
+func (p *parseParam) ListArg(n string) []float64                 { return p.r.ListArg(n) }
+func (p *parseParam) OptListArg(n string, d []float64) []float64 { return p.r.OptListArg(n, d) }
+func (p *parseParam) TickFreq() float64                          { return p.r.OptArg(defaultTickFreqName, DefaultTickFreq) }
+func (p *parseParam) TickTime() float64                          { return 1 / p.TickFreq() }
+func (p *parseParam) Err() error                                 { return p.r.Err() }
@@ -12,10 +12,19 @@ func RegisterLogicFunc(name string, fn func(a, b bool) bool) {
 
 func init() {
 	Register("not", func() Block { return new(notblk) })
-	RegisterLogicFunc("xor", func(a, b bool) bool { return a && b })
+	RegisterLogicFunc("xor", func(a, b bool) bool { return a != b })
 	RegisterLogicFunc("and", func(a, b bool) bool { return a && b })
 	RegisterLogicFunc("or", func(a, b bool) bool { return a || b })
 	RegisterType(new(ifblktype))
+
+	Describe("not", &TypeDoc{Category: "Simple blocks", Summary: "logical not"})
+	for name, sum := range map[string]string{
+		"and": "logical and",
+		"or":  "logical or",
+		"xor": "logical exclusive or",
+	} {
+		Describe(name, &TypeDoc{Category: "Simple blocks", Summary: sum})
+	}
 }
 
 type notblk struct {
@@ -48,11 +57,22 @@ func (b *logicopblk) Validate() error   { return VarArgCheck(b.typ, &b.vi, 2) }
 
 type ifblktype struct{}
 
+var ifdoc = &TypeDoc{
+	Category: "Simple blocks",
+	Summary:  "select `then` or `else` based on `cond`",
+	Ports: map[string]string{
+		"then": "any type, must match else",
+		"else": "any type, must match then",
+	},
+}
+
 func (*ifblktype) Name() string             { return "if" }
 func (*ifblktype) New(Param) (Block, error) { return new(ifblk), nil }
 func (*ifblktype) Verify(Param) error       { return nil }
-func (*ifblktype) Input() TypeInputMap      { return &ifinput{nil} }
-func (*ifblktype) Accept(in PortTypeMap) (PortTypeMap, error) {
+func (*ifblktype) Params() []ParamSpec      { return nil }
+func (*ifblktype) Doc() *TypeDoc            { return ifdoc }
+func (*ifblktype) Input(Param) TypeInputMap { return &ifinput{nil} }
+func (*ifblktype) Accept(p Param, in PortTypeMap) (PortTypeMap, error) {
 	cond, thn, els := in["cond"], in["then"], in["else"]
 	if cond != Bool {
 		return nil, fmt.Errorf("'if' needs bool 'cond'")
@@ -97,7 +117,7 @@ func (inp *ifinput) Type(sel string) PortType {
 	case "else":
 		return Any
 	}
-	panic(fmt.Sprint("if block has no input named '%s'", sel))
+	panic(fmt.Sprintf("if block has no input named '%s'", sel))
 }
 
 func (inp *ifinput) Value(sel string) interface{} {
@@ -12,7 +12,7 @@ func init() {
 		return func(v float64) float64 {
 			return v + ofs
 		}, nil
-	})
+	}, block.Req("Value", block.Axis, -2, 2))
 
 	// zero input under abs. value, reduce bigger
 	block.RegisterScalarFunc("deadzone", func(p block.Param) (func(float64) float64, error) {
@@ -30,7 +30,7 @@ func init() {
 			}
 			return v * s
 		}, nil
-	})
+	}, block.Req("Threshold", block.Axis, 0, 1))
 
 	// multiply input by factor
 	block.RegisterScalarFunc("multiply", func(p block.Param) (func(float64) float64, error) {
@@ -38,7 +38,7 @@ func init() {
 		return func(v float64) float64 {
 			return v * f
 		}, nil
-	})
+	}, block.Req("Factor", block.Number, 0, 0))
 
 	// axis sensitivivy curve (factor: 0 - linear, positive: nonlinear)
 	block.RegisterScalarFunc("curvature", func(p block.Param) (func(float64) float64, error) {
@@ -50,7 +50,7 @@ func init() {
 			}
 			return s * math.Pow(v, pow)
 		}, nil
-	})
+	}, block.Req("Factor", block.Number, -8, 8))
 
 	// truncate input above abs. value
 	block.RegisterScalarFunc("truncate", func(p block.Param) (func(float64) float64, error) {
@@ -64,7 +64,7 @@ func init() {
 			}
 			return v
 		}, nil
-	})
+	}, block.Req("Value", block.Axis, 0, 1))
 
 	// set maximum input change to value/second
 	block.RegisterScalarFunc("dampen", func(p block.Param) (func(float64) float64, error) {
@@ -87,7 +87,7 @@ func init() {
 			}
 			return pos
 		}, nil
-	})
+	}, block.Req("Value", block.Seconds, 0, 60))
 
 	// smooth inputs over time (seconds)
 	block.RegisterScalarFunc("smooth", func(p block.Param) (func(float64) float64, error) {
@@ -112,7 +112,7 @@ func init() {
 			sum += iv
 			return float64(sum) * m1
 		}, nil
-	})
+	}, block.Req("Time", block.Seconds, 0, 60))
 
 	// use input as delta, change values by speed/second
 	block.RegisterScalarFunc("incremental", func(p block.Param) (func(float64) float64, error) {
@@ -150,5 +150,72 @@ func init() {
 			}
 			return pos
 		}, nil
-	})
+	},
+		block.Req("Speed", block.PerSecond, 0, 0),
+		block.Opt("Rebound", block.PerSecond, 0, 0, 0),
+		block.Opt("QuickCenter", block.Flag, 0, 0, 0),
+	)
+
+	for name, d := range map[string]*block.TypeDoc{
+		"offset": {
+			Summary: "add a constant",
+			Text:    "`offset` adds the constant parameter `Value` to its input.",
+			Params:  map[string]string{"Value": "value added"},
+		},
+		"deadzone": {
+			Summary: "reduce input near the centre",
+			Text: "`deadzone` reduces the absolute input value with a constant `Threshold`, and " +
+				"outputs either zero if the reduced value is negative, or the reduced value with " +
+				"the sign of the input.",
+			Params: map[string]string{"Threshold": "input ignored below this absolute value"},
+		},
+		"multiply": {
+			Summary: "multiply by a constant",
+			Text:    "`multiply` multiplies the input with constant parameter `Factor`.",
+			Params:  map[string]string{"Factor": "multiplier"},
+		},
+		"curvature": {
+			Summary: "sensitivity curve",
+			Text: "`curvature` applies the power function with exponent 2 ** `Factor` to the " +
+				"input, making the input near the center less responsive, thus more precise. " +
+				"The output will have the same sign as the input.",
+			Params: map[string]string{"Factor": "0: linear, positive: exponential"},
+		},
+		"truncate": {
+			Summary: "limit absolute value",
+			Text: "`truncate` limits inputs with magnitude above `Value` to be equal to `Value`. " +
+				"The sign of the input is preserved.",
+			Params: map[string]string{"Value": "maximum absolute value"},
+		},
+		"dampen": {
+			Summary: "limit speed of change",
+			Text: "`dampen` constrains the speed its output may change. Its output chases " +
+				"its input, taking `Value` seconds to change by one. A `Value` of zero " +
+				"disables dampening.",
+			Params: map[string]string{"Value": "time needed to change by one"},
+		},
+		"smooth": {
+			Summary: "average over time",
+			Text: "`smooth` accumulates input over the specified amount of `Time`, and yields " +
+				"the average value.",
+			Params: map[string]string{"Time": "length of the period averaged"},
+		},
+		"incremental": {
+			Summary: "adjust value using input",
+			Text: "`incremental` implements a logic where the input is used to adjust an otherwise " +
+				"fixed internal value. The output is adjusted by input multiplied by `Speed` " +
+				"per second. If `Rebound` is nonzero, then the output will converge to zero by " +
+				"`Rebound` per second, if input is zero. If `QuickCenter` is nonzero, then an " +
+				"input with opposite sign compared to that of the internal value will set the " +
+				"internal value back to zero immediately.",
+			Params: map[string]string{
+				"Speed":       "change of output for full input",
+				"Rebound":     "speed of returning to zero without input",
+				"QuickCenter": "opposite input sets output to zero",
+			},
+		},
+	} {
+		d.Category = "Axis filters"
+		block.Describe(name, d)
+	}
 }
@@ -6,14 +6,57 @@ import (
 )
 
 func init() {
-	block.RegisterParam("multibutton", func(p block.Param) (block.Block, error) {
+	block.RegisterParamPorts("multibutton", func(p block.Param) (block.Block, error) {
 		return newMultiButton(p), nil
-	})
+	},
+		block.Req("NumTaps", block.Number, 1, 16),
+		block.Req("TapDelay", block.Seconds, 0, 10),
+		block.Req("KeepPushed", block.Seconds, 0, 10),
+	)
 	block.RegisterParam("doublebutton", func(p block.Param) (block.Block, error) {
 		return newDoubleButton(p), nil
+	},
+		block.Req("TapDelay", block.Seconds, 0, 10),
+		block.Req("KeepPushed", block.Seconds, 0, 10),
+	)
+
+	block.Describe("doublebutton", &block.TypeDoc{
+		Category: "Blocks with state",
+		Summary:  "button that can be double clicked",
+		Text: "`doublebutton` defines a block that can be \"double clicked\". It provides two " +
+			"outputs, one unnamed representing the input itself, and `double` which is set " +
+			"if two successive inputs came within `TapDelay` seconds. `double` will be set " +
+			"to `on` for `KeepPushed` seconds. Only one of the outputs will ever be set to " +
+			"`on`, that is, a \"double click\" forces the unnamed output to be `off` for the " +
+			"time being itself is pushed.",
+		Ports:  map[string]string{"double": "input pushed twice"},
+		Params: tapParams,
+	})
+	block.Describe("multibutton", &block.TypeDoc{
+		Category: "Blocks with state",
+		Summary:  "button push counter",
+		Text: "`multibutton` is a push counter. It counts how many times a button was pressed " +
+			"with at most `TapDelay` seconds between button pushes, and sets the " +
+			"corresponding numbered output to `on` for `KeepPushed` seconds. Only one of the " +
+			"outputs will be set, meaning two quick pushes will yield an output on `2` only, " +
+			"but not on `1`.\n\n" +
+			"This means `multibutton` has to wait `TapDelay` seconds after the last button " +
+			"press to know which output must be set, therefore a `multibutton` with two " +
+			"outputs is different than `doublebutton` in this regard.",
+		Params: map[string]string{
+			"NumTaps":    "number of outputs",
+			"TapDelay":   tapParams["TapDelay"],
+			"KeepPushed": tapParams["KeepPushed"],
+		},
 	})
 }
 
+// tapParams documents parameters of blocks reacting to repeated pushes.
+var tapParams = map[string]string{
+	"TapDelay":   "maximum time between pushes",
+	"KeepPushed": "time outputs are held",
+}
+
 func newDoubleButton(p block.Param) block.Block {
 	b := new(doubleButton)
 	b.taptick = uint(p.Arg("TapDelay") * p.TickFreq())
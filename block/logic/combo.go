@@ -7,6 +7,20 @@ import (
 func init() {
 	block.RegisterParam("combo", func(p block.Param) (block.Block, error) {
 		return newCombohat(p), nil
+	},
+		block.Req("TapDelay", block.Seconds, 0, 10),
+		block.Req("KeepPushed", block.Seconds, 0, 10),
+	)
+	block.Describe("combo", &block.TypeDoc{
+		Category: "Blocks with state",
+		Summary:  "multiplex a hat",
+		Text: "`combo` multiplexes a single hat input to create four hat outputs. An output is triggered " +
+			"if any of the hats are pressed twice within `TapDelay` seconds. The first input selects " +
+			"one of the outputs `n`, `s`, `e` and `w`, the second tells what value it should be set for " +
+			"`KeepPushed` seconds. The unnamed output will be set for `KeepPushed` seconds if only " +
+			"one press happens within `TapDelay` seconds. `combo` will output cardinal directions only, " +
+			"and requires that the hat is released before moving on.",
+		Params: tapParams,
 	})
 }
 
@@ -14,6 +14,44 @@ func init() {
 	block.RegisterHatFunc("hatadd", func(a, b int) int { return a | b })
 	block.RegisterHatFunc("hatsub", func(a, b int) int { return a & ^b })
 	block.RegisterHatFunc("hatxor", func(a, b int) int { return a ^ b })
+
+	cardinal := map[string]string{
+		"n": "north",
+		"s": "south",
+		"e": "east",
+		"w": "west",
+	}
+	block.Describe("hatelem", &block.TypeDoc{
+		Category: "Special blocks",
+		Summary:  "decompose a hat into bool values",
+		Text:     "`hatelem` decomposes a hat into four distinct bool outputs named after the cardinal directions.",
+		Ports:    cardinal,
+		Example: `block input [gamepad]
+block dpaddir [hatelem input.dpad]
+port dpadup    dpaddir.n
+port dpaddown  dpaddir.s
+port dpadleft  dpaddir.w
+port dpadright dpaddir.e`,
+	})
+	block.Describe("makehat", &block.TypeDoc{
+		Category: "Special blocks",
+		Summary:  "combine bool values into a hat",
+		Text:     "`makehat` combines four bool inputs named after the cardinal directions into a hat.",
+		Ports:    cardinal,
+		Example: `block input [gamepad]
+block buttonshat [makehat]
+conn buttonshat.n input.y
+conn buttonshat.s input.a
+conn buttonshat.w input.x
+conn buttonshat.e input.b`,
+	})
+	for name, sum := range map[string]string{
+		"hatadd": "combine hat values",
+		"hatsub": "hat directions of `x` not in `y`",
+		"hatxor": "flip directions of `x` set in `y`",
+	} {
+		block.Describe(name, &block.TypeDoc{Category: "Simple blocks", Summary: sum})
+	}
 }
 
 type hatelem struct {
@@ -8,9 +8,62 @@ import (
 func init() {
 	block.RegisterParam("headlook", func(p block.Param) (block.Block, error) {
 		return newHeadlook(p), nil
-	})
+	},
+		block.Req("MovePerSec", block.PerSecond, 0, 0),
+		block.Req("AutoCenterDist", block.Axis, 0, 1),
+		block.Req("AutoCenterAccel", block.PerSecond, 0, 0),
+		block.Req("JumpToCenterAccel", block.PerSecond, 0, 0),
+	)
 	block.RegisterParam("pedals", func(p block.Param) (block.Block, error) {
 		return newPedals(p), nil
+	},
+		block.Req("AxisThreshold", block.Axis, 0, 1),
+		block.Req("BreakThreshold", block.Axis, 0, 1),
+		block.Req("Exp", block.Number, 0, 0),
+	)
+
+	block.Describe("headlook", &block.TypeDoc{
+		Category: "Blocks with state",
+		Summary:  "incremental head look",
+		Text: "`headlook` is for incremental head look behavior with optional snap to centre. " +
+			"Its outputs move with its inputs at `MovePerSec`, and return to the centre " +
+			"if there is no input and they are within `AutoCenterDist`.",
+		Ports: map[string]string{
+			"reset": "jump to centre",
+		},
+		Params: map[string]string{
+			"MovePerSec":        "speed of movement for full input",
+			"AutoCenterDist":    "return to centre within this distance",
+			"AutoCenterAccel":   "acceleration when returning to centre",
+			"JumpToCenterAccel": "acceleration when reset",
+		},
+		Example: `block input [gamepad]
+block headlooktoggle [toggle input.rthumb]
+block headlook [headlook: MovePerSec=2.0 AutoCenterDist=0.2 AutoCenterAccel=0.001 JumpToCenterAccel=0.1]
+conn headlook.x [if headlooktoggle input.rx 0]
+conn headlook.y [if headlooktoggle input.ry 0]
+conn headlook.reset [not headlooktoggle]`,
+	})
+	block.Describe("pedals", &block.TypeDoc{
+		Category: "Special blocks",
+		Summary:  "combine two axes into one",
+		Text: "`pedals` takes two axis values and turn them into a single combined axis. " +
+			"In addition to that a boolean flag will be set if both inputs are in use. " +
+			"The axis output is always zero if break is `on`.",
+		Ports: map[string]string{
+			"break": "both inputs are in use",
+		},
+		Params: map[string]string{
+			"AxisThreshold":  "only use input above this threshold for axis output",
+			"BreakThreshold": "only use input above this threshold for break output",
+			"Exp":            "exponent to use on axis output (1: linear)",
+		},
+		Example: `# z is the rudder, button 1 is the break
+block input [gamepad]
+block output [vjoy]
+block triggeryaw [pedals input.lt input.rt: AxisThreshold=0.15 BreakThreshold=0.05 Exp=1.5]
+conn output.z triggeryaw
+conn output.1 triggeryaw.break`,
 	})
 }
 
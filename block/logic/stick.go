@@ -21,7 +21,7 @@ func init() {
 			}
 			return
 		}, nil
-	})
+	}, block.Req("Threshold", block.Axis, 0, 1))
 
 	// the circular positions into positions on the square (0 < factor < 1)
 	block.RegisterStickFunc("circlesquare", func(p block.Param) (block.StickFunc, error) {
@@ -46,6 +46,26 @@ func init() {
 			yo = yi * (of + m)
 			return
 		}, nil
-	})
+	}, block.Opt("Factor", block.Number, 1, 0, 1))
 
+	block.Describe("circulardeadzone", &block.TypeDoc{
+		Category: "Stick filters",
+		Summary:  "reduce stick vectors near the centre",
+		Text: "`circulardeadzone` is used for inputs representing movement. Vectors around " +
+			"the centre closer than `Threshold` will report zero. Output for vectors outside " +
+			"the circle defined by `Threshold` will have the same direction as the input, " +
+			"with magnitude reduced by `Threshold`.",
+		Params: map[string]string{"Threshold": "radius of the circle ignored"},
+	})
+	block.Describe("circlesquare", &block.TypeDoc{
+		Category: "Stick filters",
+		Summary:  "map the circle onto the square",
+		Text: "`circlesquare` converts the `x` and `y` axis positions in a circle into vectors " +
+			"on a square. This lets gamepad stick vectors constrained to be within the range " +
+			"less than or equal to one around the center to reach the extreme corner " +
+			"coordinates. That is, an input of x,y=√2,√2 yields x,y=1,1.\n\n" +
+			"Using this block is not recommended, `multiply` on the two axes typically " +
+			"produce more intuitive behaviour.",
+		Params: map[string]string{"Factor": "0: output is same as input, 1: full effect"},
+	})
 }
@@ -31,6 +31,21 @@ func init() {
 		}
 		return b
 	})
+
+	for name, sum := range map[string]string{
+		"add":    "sum of inputs",
+		"sub":    "first input minus the others",
+		"mul":    "product of inputs",
+		"div":    "first input divided by the others",
+		"mod":    "remainder of dividing the first input by the others",
+		"pow":    "first input raised to the power of the others",
+		"min":    "smallest input",
+		"max":    "largest input",
+		"absmin": "input with the smallest absolute value",
+		"absmax": "input with the largest absolute value",
+	} {
+		Describe(name, &TypeDoc{Category: "Simple blocks", Summary: sum})
+	}
 }
 
 type mathopblk struct {
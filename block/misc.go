@@ -7,14 +7,14 @@ import (
 
 const debug = false
 
-func RegisterScalarFunc(name string, fn func(Param) (func(float64) float64, error)) {
+func RegisterScalarFunc(name string, fn func(Param) (func(float64) float64, error), specs ...ParamSpec) {
 	RegisterParam(name, func(p Param) (Block, error) {
 		f, err := fn(p)
 		if err != nil {
 			return nil, err
 		}
 		return &scalarfnblk{typ: name, f: f}, nil
-	})
+	}, specs...)
 }
 
 type scalarfnblk struct {
@@ -45,7 +45,18 @@ func init() {
 			set:   unsetBool,
 			reset: unsetBool,
 		}, nil
-	}})
+	}, nil, false, nil})
+	Describe("toggle", &TypeDoc{
+		Category: "Blocks with state",
+		Summary:  "bool value toggled by input",
+		Text: "`toggle` outputs a fixed bool value that is toggled when the unnamed input " +
+			"is changed from `off` to `on`. Inputs `set` and `reset` turn the value " +
+			"`on` and `off`, respectively.",
+		Ports: map[string]string{
+			"set":   "set value to `on`",
+			"reset": "set value to `off`",
+		},
+	})
 }
 
 type toggle struct {
@@ -84,14 +95,14 @@ func (b *toggle) Validate() error {
 	return nil
 }
 
-func RegisterBoolFunc(name string, fn func(Param) (func(bool) bool, error)) {
+func RegisterBoolFunc(name string, fn func(Param) (func(bool) bool, error), specs ...ParamSpec) {
 	RegisterParam(name, func(p Param) (Block, error) {
 		f, err := fn(p)
 		if err != nil {
 			return nil, err
 		}
 		return &boolfnblk{typ: name, f: f}, nil
-	})
+	}, specs...)
 }
 
 type boolfnblk struct {
@@ -108,7 +119,7 @@ func (b *boolfnblk) Validate() error   { return CheckInputs(b.typ, &b.i) }
 
 type StickFunc func(xi, yi float64) (xo, yo float64)
 
-func RegisterStickFunc(name string, ff func(p Param) (StickFunc, error)) {
+func RegisterStickFunc(name string, ff func(p Param) (StickFunc, error), specs ...ParamSpec) {
 	RegisterParam(name, func(p Param) (Block, error) {
 		f, err := ff(p)
 		if err != nil {
@@ -116,7 +127,7 @@ func RegisterStickFunc(name string, ff func(p Param) (StickFunc, error)) {
 		}
 		b := &stickfuncblk{typ: name, f: f}
 		return b, nil
-	})
+	}, specs...)
 }
 
 type stickfuncblk struct {
@@ -145,12 +156,17 @@ type hatfuncblk struct {
 }
 
 func (b *hatfuncblk) Input() InputMap   { return MapInput(b.typ, pt("x", &b.xi), pt("y", &b.yi)) }
-func (b *hatfuncblk) Output() OutputMap { return SingleOutput(b.typ, pt("", &b.o)) }
+func (b *hatfuncblk) Output() OutputMap { return SingleOutput(b.typ, &b.o) }
 func (b *hatfuncblk) Validate() error   { return CheckInputs(b.typ, &b.xi, &b.yi) }
 func (b *hatfuncblk) Tick()             { b.o = b.f(*b.xi, *b.yi) }
 
 func init() {
 	Register("stick", func() Block { return new(stickblk) })
+	Describe("stick", &TypeDoc{
+		Category: "Stick filters",
+		Summary:  "pass axis values as a stick",
+		Text:     "`stick` outputs its inputs unchanged. It is used to combine two axes into a stick.",
+	})
 }
 
 type stickblk struct {
@@ -1,42 +1,159 @@
 package parser
 
 func newcontext(t TypeMap) *context {
+	s := newscope(nil, nil)
+	s.portNames = map[string]specSource{
+		"true":       constbool(true),
+		"on":         constbool(true),
+		"false":      constbool(false),
+		"off":        constbool(false),
+		"hat_off":    constint(hatC),
+		"hat_centre": constint(hatC),
+		"hat_center": constint(hatC),
+		"hat_north":  constint(hatN),
+		"hat_east":   constint(hatE),
+		"hat_south":  constint(hatS),
+		"hat_west":   constint(hatW),
+		"centre":     constint(hatC),
+		"center":     constint(hatC),
+		"north":      constint(hatN),
+		"east":       constint(hatE),
+		"south":      constint(hatS),
+		"west":       constint(hatW),
+	}
 	return &context{
-		TypeMap:     t,
-		config:      make(map[string]float64),
-		sinkNames:   make(portMap),
-		sourceNames: make(portMap),
-		portNames: map[string]specSource{
-			"true":       constbool(true),
-			"on":         constbool(true),
-			"false":      constbool(false),
-			"off":        constbool(false),
-			"hat_off":    constint(hatC),
-			"hat_centre": constint(hatC),
-			"hat_center": constint(hatC),
-			"hat_north":  constint(hatN),
-			"hat_east":   constint(hatE),
-			"hat_south":  constint(hatS),
-			"hat_west":   constint(hatW),
-			"centre":     constint(hatC),
-			"center":     constint(hatC),
-			"north":      constint(hatN),
-			"east":       constint(hatE),
-			"south":      constint(hatS),
-			"west":       constint(hatW),
-		},
+		TypeMap: t,
+		scope:   s,
+		config:  make(NamedParam),
+		defs:    make(map[string]*def),
+		layers:  make(map[string]*layer),
+		sets:    make(map[string]bool),
+		used:    make(map[specSource]bool),
+		srcpos:  make(map[specSource]int),
 	}
 }
 
 type context struct {
 	TypeMap
-	config      map[string]float64
+	*scope                    // names of the def instance being parsed, or the top level
+	src       *source         // source being parsed
+	files     []string        // files included
+	defines   NamedParam      // values overriding set statements
+	conds     []*cond         // if statements open
+	defs      map[string]*def // block types defined in the config
+	expanding []*def          // defs being expanded
+	groups    []*instance     // groups having in and out declarations
+	config    NamedParam
+	vblk      []*Blk
+	vlink     []Link
+	maps      []*mapping        // map statements, expanded into links by sort
+	layers    map[string]*layer // layers by name with prefix
+	layer     *layer            // layer being parsed
+	sets      map[string]bool   // names of config values of set statements
+	aliases   []alias           // ports declared by port statements
+	used      map[specSource]bool
+	srcpos    map[specSource]int // positions of sources parsed
+}
+
+// alias is a port declared by a port statement.
+type alias struct {
+	name string
+	s    *namedsource // used when it is found in used
+}
+
+// scope holds the names defined at the top level, or within a def instance or group.
+// Names not found are looked up in the parent scope.
+type scope struct {
+	parent      *scope
+	inst        *instance       // def instance or group, nil at top level
+	prefix      string          // prefix of block names
+	values      NamedParam      // constants, and parameters of inst
+	badNames    map[string]bool // names of blocks and ports with errors
 	portNames   map[string]specSource
 	sinkNames   portMap
 	sourceNames portMap
-	blklno      map[*Blk]int
-	vblk        []*Blk
-	vlink       []Link
+}
+
+func newscope(parent *scope, inst *instance) *scope {
+	s := &scope{
+		parent:      parent,
+		inst:        inst,
+		values:      make(NamedParam),
+		badNames:    make(map[string]bool),
+		portNames:   make(map[string]specSource),
+		sinkNames:   make(portMap),
+		sourceNames: make(portMap),
+	}
+	if inst != nil {
+		s.prefix = inst.name + "/"
+	}
+	return s
+}
+
+// lookup returns the value of a constant or def parameter called name.
+func (s *scope) lookup(name string) (interface{}, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.values[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// bad reports if name was marked bad in s or its parents.
+func (s *scope) bad(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.badNames[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// sink looks up the block having input ports called name.
+func (s *scope) sink(name string) (portMapper, bool) {
+	for ; s != nil; s = s.parent {
+		if pm, ok := s.sinkNames[name]; ok {
+			return pm, true
+		}
+	}
+	return nil, false
+}
+
+// source looks up the port or block having output ports called name.
+// Ports and blocks of inner scopes hide those of outer ones.
+func (s *scope) source(name string) (specSource, portMapper) {
+	for ; s != nil; s = s.parent {
+		if p, ok := s.portNames[name]; ok {
+			return p, nil
+		}
+		if pm, ok := s.sourceNames[name]; ok {
+			return nil, pm
+		}
+	}
+	return nil, nil
+}
+
+// names returns names visible in s for sinks, or sources and ports.
+func (s *scope) names(sink bool) []string {
+	var v []string
+	for ; s != nil; s = s.parent {
+		if sink {
+			v = append(v, mapnames(s.sinkNames)...)
+		} else {
+			v = append(v, mapnames(s.sourceNames)...)
+			v = append(v, specnames(s.portNames)...)
+		}
+	}
+	return v
+}
+
+// cond is an if statement.
+type cond struct {
+	src     *source
+	scope   *scope
+	pos     int
+	haselse bool
 }
 
 type portMap map[string]portMapper
@@ -47,6 +164,29 @@ type portMapper interface {
 type Link struct {
 	sink   specSink
 	source specSource
+	src    *source // source of the statement
+	layer  *layer  // layer of the statement, if any
+}
+
+// linkerror returns msg located at the source of l if its position
+// is known, or at the statement of l otherwise.
+func (c *context) linkerror(l Link, msg error) error {
+	if pos, ok := c.srcpos[l.source]; ok {
+		return l.error(l.src.errorat(pos, msg))
+	}
+	if k, ok := l.sink.(*namedsink); ok {
+		return l.error(k.src.errorat(k.pos, msg))
+	}
+	return l.error(msg)
+}
+
+// error returns err located at the statement of l.
+func (l Link) error(err error) error {
+	err = srcerr(l.sink, err)
+	if e, ok := err.(*Error); ok {
+		l.src.annotate(e)
+	}
+	return err
 }
 
 func (l Link) markdep(c *context, f func(*Blk, *Blk)) error {
@@ -64,12 +204,12 @@ func (l Link) markdep(c *context, f func(*Blk, *Blk)) error {
 	return nil
 }
 
-func (l Link) setup(c *context) error {
+func (l Link) setup(c *context) (Source, error) {
 	src, err := l.source.Source(c)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return l.sink.SetTo(c, src)
+	return src, l.sink.SetTo(c, src)
 }
 
 type specSink interface {
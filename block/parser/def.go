@@ -0,0 +1,411 @@
+package parser
+
+// def is a block type defined in the config using a def statement.
+// Its body is parsed for each instance, so that the blocks
+// within are created with the parameters of the instance.
+// Groups having in and out declarations are instances
+// of a def with group set.
+type def struct {
+	name    string
+	group   bool
+	inputs  []string
+	outputs []string
+	params  []defparam
+
+	src   *source
+	pos   int    // start of the def statement
+	body  int    // start of the body
+	line  int    // line number of the body
+	scope *scope // scope of the def statement
+}
+
+func (d *def) String() string {
+	if d.group {
+		return "group '" + d.name + "'"
+	}
+	return "def '" + d.name + "'"
+}
+
+type defparam struct {
+	name  string
+	opt   bool        // parameter has a default
+	value interface{} // default value
+}
+
+// values returns the values of the parameters of d using param.
+// Parameters missing are looked up in config.
+func (d *def) values(param Param, config NamedParam) (NamedParam, error) {
+	r := newparamreader(param, config)
+	m := make(NamedParam)
+	for _, dp := range d.params {
+		v, ok := r.value(dp.name, dp.opt)
+		if !ok {
+			v = dp.value
+		}
+		m[dp.name] = v
+	}
+	if err := r.Err(); err != nil {
+		return nil, errf("def '%s': %v", d.name, err)
+	}
+	return m, nil
+}
+
+// portname returns the name of port sel in names. Defs with a
+// single input or output can refer to it using an empty selector.
+func portname(names []string, sel string) string {
+	if sel == "" && len(names) == 1 {
+		return names[0]
+	}
+	return sel
+}
+
+// instance is a block created from a def.
+type instance struct {
+	def     *def
+	name    string
+	src     *source
+	pos     int
+	inputs  map[string]specSource // sources connected to inputs
+	outputs map[string]specSource // sources set by out statements
+}
+
+func (i *instance) port(sel string) (*Blk, string, error) {
+	return nil, "", errf("%s can't be used here", i.def)
+}
+
+// bind connects s to input sel of i.
+func (i *instance) bind(sel string, s specSource) error {
+	n := portname(i.def.inputs, sel)
+	if !has(i.def.inputs, n) {
+		return errf("%s has no %s", i.def, nice(inport, sel))
+	}
+	if _, ok := i.inputs[n]; ok {
+		return errf("%s of '%s' connected twice", nice(inport, n), i.name)
+	}
+	i.inputs[n] = s
+	return nil
+}
+
+// instinput is an input of an instance referred to within its body.
+type instinput struct {
+	inst *instance
+	name string
+}
+
+func (a *instinput) source() (specSource, error) {
+	if s, ok := a.inst.inputs[a.name]; ok {
+		return s, nil
+	}
+	return nil, a.inst.src.errorat(a.inst.pos, errf("%s of '%s' not connected", nice(inport, a.name), a.inst.name))
+}
+
+func (a *instinput) Blk(c *context) (*Blk, error) {
+	s, err := a.source()
+	if err != nil {
+		return nil, err
+	}
+	return s.Blk(c)
+}
+
+func (a *instinput) Source(c *context) (Source, error) {
+	s, err := a.source()
+	if err != nil {
+		return nil, err
+	}
+	return s.Source(c)
+}
+
+// instoutput is an output of an instance.
+type instoutput struct {
+	inst *instance
+	sel  string
+	src  *source
+	pos  int
+}
+
+func (o *instoutput) source() (specSource, error) {
+	n := portname(o.inst.def.outputs, o.sel)
+	if s, ok := o.inst.outputs[n]; ok {
+		return s, nil
+	}
+	if has(o.inst.def.outputs, n) {
+		// output not set is reported for the def or group
+		return nil, errBadName
+	}
+	e := o.src.errorat(o.pos, errf("%s has no %s", o.inst.def, nice(outport, o.sel)))
+	e.Hint = suggest(o.sel, o.inst.def.outputs)
+	return nil, e
+}
+
+func (o *instoutput) Blk(c *context) (*Blk, error) {
+	s, err := o.source()
+	if err != nil {
+		return nil, err
+	}
+	return s.Blk(c)
+}
+
+func (o *instoutput) Source(c *context) (Source, error) {
+	s, err := o.source()
+	if err != nil {
+		return nil, err
+	}
+	return s.Source(c)
+}
+
+// groupoutput is an output of a group referred to within its body.
+type groupoutput struct {
+	inst *instance
+	name string
+}
+
+func (o *groupoutput) port(sel string) (*Blk, string, error) {
+	return nil, "", errf("%s of %s can't be used here", nice(outport, o.name), o.inst.def)
+}
+
+// bind sets the output of the group to s.
+func (o *groupoutput) bind(sel string, s specSource) error {
+	if sel != "" {
+		return errf("%s of %s has no ports", nice(outport, o.name), o.inst.def)
+	}
+	if _, ok := o.inst.outputs[o.name]; ok {
+		return errf("%s of %s connected twice", nice(outport, o.name), o.inst.def)
+	}
+	o.inst.outputs[o.name] = s
+	return nil
+}
+
+// parsedef parses a def statement starting at pos. The body
+// is skipped, it is parsed for each instance by expand.
+func (p *parser) parsedef(pos int) {
+	if p.inst != nil {
+		panic(errf("def not allowed within %s", p.inst.def))
+	}
+	defer p.recoverheader(pos, "def")
+	d := &def{src: p.src, pos: pos, scope: p.scope}
+	p.r.skiplinespace()
+	npos := p.r.pos
+	d.name = p.r.name()
+	if _, ok := p.defs[d.name]; ok {
+		panic(p.src.errorat(npos, errf("duplicate def '%s'", d.name)))
+	}
+	if _, err := p.GetType(d.name); err == nil {
+		panic(p.src.errorat(npos, errf("def '%s' hides block type", d.name)))
+	}
+	p.r.skiplinespace()
+	if !p.r.eatch('(') {
+		panic("'(' expected after def name")
+	}
+	d.inputs = p.names()
+	if p.r.eatch(':') {
+		for {
+			p.r.skiplinespace()
+			if !isnamestart(p.r.ch()) {
+				break
+			}
+			dp := defparam{name: p.r.name()}
+			if p.r.eatch('=') {
+				dp.opt, dp.value = true, p.value()
+			}
+			d.params = append(d.params, dp)
+		}
+	}
+	if !p.r.eatch(')') {
+		panic("')' expected after def inputs and parameters")
+	}
+	p.r.skiplinespace()
+	if p.r.eatch('-') {
+		if !p.r.eatch('>') {
+			panic("'->' expected")
+		}
+		p.r.skiplinespace()
+		if !p.r.eatch('(') {
+			panic("'(' expected before def outputs")
+		}
+		d.outputs = p.names()
+		if !p.r.eatch(')') {
+			panic("')' expected after def outputs")
+		}
+	}
+	p.r.endstatement()
+	d.body, d.line = p.r.pos, p.r.nline
+	p.skipbody(pos, "def")
+	p.defs[d.name] = d
+}
+
+// names parses a list of distinct names.
+func (p *parser) names() []string {
+	var v []string
+	for {
+		p.r.skiplinespace()
+		if !isnamestart(p.r.ch()) {
+			return v
+		}
+		pos := p.r.pos
+		n := p.r.name()
+		if has(v, n) {
+			panic(p.src.errorat(pos, errf("duplicate name '%s'", n)))
+		}
+		v = append(v, n)
+	}
+}
+
+// skipbody skips the body of the def or for statement
+// kw starting at pos, and its end.
+func (p *parser) skipbody(pos int, kw string) {
+	depth := 0
+	for !p.r.eof() {
+		p.r.skipallspace()
+		switch {
+		case p.r.at("if"), p.r.at("def"), p.r.at("for"), p.r.at("layer"):
+			depth++
+		case p.r.at("end"):
+			if depth == 0 {
+				p.r.eat("end")
+				p.r.endstatement()
+				return
+			}
+			depth--
+		}
+		p.r.skipline()
+	}
+	panic(p.src.errorat(pos, kw+" without end"))
+}
+
+// recoverheader is deferred while parsing the header of the def, for or
+// layer statement kw at pos. Errors in the header are reported after
+// skipping the body, so that it is not parsed as top level statements.
+func (p *parser) recoverheader(pos int, kw string) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			e = p.src.errorat(p.r.pos, r)
+		}
+		p.r.skipline()
+		p.skipbody(pos, kw)
+		panic(e)
+	}
+}
+
+// expand creates the instance name of d at pos, and parses
+// the body of d using param.
+func (p *parser) expand(d *def, name string, param Param, pos int) *instance {
+	for _, x := range p.expanding {
+		if x == d {
+			panic(p.src.errorat(pos, errf("def '%s' used within itself", d.name)))
+		}
+	}
+	values, err := d.values(param, p.config)
+	if err != nil {
+		panic(p.src.errorat(pos, err))
+	}
+	inst := &instance{
+		def:     d,
+		name:    p.prefix + name,
+		src:     p.src,
+		pos:     pos,
+		inputs:  make(map[string]specSource),
+		outputs: make(map[string]specSource),
+	}
+
+	// the body of d is the same wherever d is used, even within layers
+	r, src, sc, l := p.r, p.src, p.scope, p.layer
+	p.expanding = append(p.expanding, d)
+	defer func() {
+		p.r, p.src, p.scope, p.layer = r, src, sc, l
+		p.expanding = p.expanding[:len(p.expanding)-1]
+	}()
+	p.layer = nil
+	p.src = d.src
+	p.r = &sourcereader{src: d.src.src, pos: d.body, nline: d.line, subst: p.subst}
+	p.scope = newscope(d.scope, inst)
+	p.scope.values = values
+	for _, n := range d.inputs {
+		p.portNames[n] = &instinput{inst, n}
+	}
+	nconds, nerrs := len(p.conds), len(p.errs)
+	for {
+		p.r.skipallspace()
+		if p.r.eof() || (len(p.conds) == nconds && p.r.at("end")) {
+			break
+		}
+		p.statement()
+	}
+	p.checkconds(nconds)
+	if len(p.errs) != nerrs {
+		// outputs might be missing due to errors
+		return inst
+	}
+	for _, n := range d.outputs {
+		if _, ok := inst.outputs[n]; !ok {
+			p.errs = append(p.errs, d.src.errorat(d.pos, errf("%s of def '%s' not set", nice(outport, n), d.name)))
+		}
+	}
+	return inst
+}
+
+// parsesubgraph parses the body of group name up to its closing brace.
+// The body has in and out statements declaring the ports of the group,
+// and other statements wiring them up. Names of blocks within are
+// prefixed with the name of the group and a hash mark, e.g. "g#blk".
+func (p *parser) parsesubgraph(name string, pos int) *instance {
+	inst := &instance{
+		def:     &def{name: name, group: true, src: p.src, pos: pos, scope: p.scope},
+		name:    p.prefix + name,
+		src:     p.src,
+		pos:     pos,
+		inputs:  make(map[string]specSource),
+		outputs: make(map[string]specSource),
+	}
+
+	// links within the group are not those of a layer it is in
+	sc, l := p.scope, p.layer
+	defer func() {
+		p.scope, p.layer = sc, l
+	}()
+	p.layer = nil
+	p.scope = newscope(sc, inst)
+	p.scope.prefix = inst.name + "#"
+	nconds, nerrs := len(p.conds), len(p.errs)
+	for {
+		p.r.skipallspace()
+		if p.r.eof() {
+			panic(p.src.errorat(pos, "unclosed group"))
+		}
+		if p.r.eatch('}') {
+			break
+		}
+		p.statement()
+	}
+	p.checkconds(nconds)
+	if len(p.errs) == nerrs {
+		// outputs might be missing due to errors
+		p.groups = append(p.groups, inst)
+	}
+	return inst
+}
+
+// declare adds the ports of the group being parsed
+// named in an in or out statement.
+func (p *parser) declare(out bool) {
+	d := p.inst.def
+	for {
+		p.r.skiplinespace()
+		if !isnamestart(p.r.ch()) {
+			break
+		}
+		pos := p.r.pos
+		n := p.r.name()
+		if has(d.inputs, n) || has(d.outputs, n) {
+			panic(p.src.errorat(pos, errf("duplicate %s", nice(port, n))))
+		}
+		if out {
+			d.outputs = append(d.outputs, n)
+			p.sinkNames[n] = &groupoutput{p.inst, n}
+		} else {
+			d.inputs = append(d.inputs, n)
+			p.portNames[n] = &instinput{p.inst, n}
+		}
+	}
+	p.r.endstatement()
+}
@@ -1,37 +1,125 @@
 package parser
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 )
 
 type srcliner interface {
 	SrcLine() int
 }
 
-func errf(f string, v ...interface{}) error {
-	return fmt.Errorf(f, v...)
+// Error is a problem found at a position in the source.
+type Error struct {
+	File string // source file name, empty if unknown
+	Line int    // line number, starting at 1
+	Col  int    // column in characters starting at 1, or 0 if unknown
+	Msg  string
+	Text string // source line of the problem
+	Hint string // similar name suggested, if any
 }
 
-type sourceerror struct {
-	name   string
-	lineno int
-	err    error
+func (e *Error) Error() string {
+	var buf bytes.Buffer
+	if e.File != "" {
+		fmt.Fprintf(&buf, "%s:%d:", e.File, e.Line)
+		if e.Col > 0 {
+			fmt.Fprintf(&buf, "%d:", e.Col)
+		}
+	} else {
+		fmt.Fprintf(&buf, "line %d", e.Line)
+		if e.Col > 0 {
+			fmt.Fprintf(&buf, " col %d", e.Col)
+		}
+		buf.WriteByte(':')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(e.Msg)
+	if e.Hint != "" {
+		fmt.Fprintf(&buf, " (did you mean '%s'?)", e.Hint)
+	}
+	if e.Text != "" {
+		buf.WriteString("\n\t")
+		buf.WriteString(e.Text)
+		if e.Col > 0 {
+			// keep tabs so the caret lines up
+			buf.WriteString("\n\t")
+			i := 0
+			for _, r := range e.Text {
+				if i++; i >= e.Col {
+					break
+				}
+				if r == '\t' {
+					buf.WriteByte('\t')
+				} else {
+					buf.WriteByte(' ')
+				}
+			}
+			buf.WriteByte('^')
+		}
+	}
+	return buf.String()
+}
+
+// ErrorList is a list of problems found in a profile.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	s := make([]string, len(l))
+	for i, err := range l {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
 }
 
-func (e *sourceerror) Error() string {
-	name := e.name
-	if name != "" {
-		name = "{input}"
+// sortbyline sorts Errors in l by their position. Files are
+// kept in the order of their first error.
+func (l ErrorList) sortbyline() {
+	files := make(map[string]int)
+	for _, err := range l {
+		if e, ok := err.(*Error); ok {
+			if _, ok := files[e.File]; !ok {
+				files[e.File] = len(files)
+			}
+		}
+	}
+	less := func(a, b error) bool {
+		ea, _ := a.(*Error)
+		eb, _ := b.(*Error)
+		if ea == nil || eb == nil {
+			return ea == nil && eb != nil
+		}
+		if fa, fb := files[ea.File], files[eb.File]; fa != fb {
+			return fa < fb
+		}
+		return ea.Line < eb.Line || (ea.Line == eb.Line && ea.Col < eb.Col)
+	}
+	for i := 1; i < len(l); i++ {
+		for j := i; j > 0 && less(l[j], l[j-1]); j-- {
+			l[j], l[j-1] = l[j-1], l[j]
+		}
 	}
-	return fmt.Sprintf("%s:%d: ", name, e.lineno) + e.err.Error()
 }
 
-func setsrc(obj interface{}, name string) error {
-	if e, ok := obj.(*sourceerror); ok {
-		return &sourceerror{name, e.lineno, e.err}
+// unique returns l without repeated problems,
+// such as those within the body of defs used several times.
+func (l ErrorList) unique() ErrorList {
+	seen := make(map[string]bool)
+	var r ErrorList
+	for _, err := range l {
+		if s := err.Error(); !seen[s] {
+			seen[s] = true
+			r = append(r, err)
+		}
 	}
-	return &sourceerror{name, -1, errors.New(fmt.Sprint(obj))}
+	return r
+}
+
+func errf(f string, v ...interface{}) error {
+	return fmt.Errorf(f, v...)
 }
 
 func srcerr(obj interface{}, i interface{}) error {
@@ -39,12 +127,14 @@ func srcerr(obj interface{}, i interface{}) error {
 	case srcliner:
 		n := s.SrcLine()
 		switch x := i.(type) {
-		case *sourceerror:
+		case *Error:
+			return x
+		case ErrorList:
 			return x
 		case error:
-			return &sourceerror{"", n, x}
+			return &Error{Line: n, Msg: x.Error()}
 		}
-		return &sourceerror{"", n, errors.New(fmt.Sprint(i))}
+		return &Error{Line: n, Msg: fmt.Sprint(i)}
 	case error:
 		return s
 	}
@@ -54,3 +144,67 @@ func srcerr(obj interface{}, i interface{}) error {
 func srcerrf(s interface{}, f string, args ...interface{}) error {
 	return srcerr(s, fmt.Sprintf(f, args...))
 }
+
+// source is the text being parsed, used to set up Errors.
+type source struct {
+	name string
+	src  []byte
+
+	abs    string  // absolute path of included files
+	parent *source // source including this one
+}
+
+// line returns the text of line lno, and the offset where it starts.
+func (s *source) line(lno int) (text string, start int) {
+	for n := 1; n < lno; n++ {
+		i := bytes.IndexByte(s.src[start:], '\n')
+		if i == -1 {
+			return "", len(s.src)
+		}
+		start += i + 1
+	}
+	end := bytes.IndexByte(s.src[start:], '\n')
+	if end == -1 {
+		end = len(s.src) - start
+	}
+	return strings.TrimRight(string(s.src[start:start+end]), "\r"), start
+}
+
+// errorat returns an Error for the position pos in the source.
+func (s *source) errorat(pos int, msg interface{}) *Error {
+	if pos > len(s.src) {
+		pos = len(s.src)
+	}
+	lno := 1 + bytes.Count(s.src[:pos], []byte{'\n'})
+	text, start := s.line(lno)
+	return &Error{
+		File: s.name,
+		Line: lno,
+		Col:  1 + utf8.RuneCount(s.src[start:pos]),
+		Msg:  fmt.Sprint(msg),
+		Text: text,
+	}
+}
+
+// annotate sets the file name and source text of e,
+// unless they are set already.
+func (s *source) annotate(e *Error) *Error {
+	if e.Text == "" && e.Line > 0 {
+		e.File = s.name
+		e.Text, _ = s.line(e.Line)
+	}
+	return e
+}
+
+// annotateall annotates Errors in err.
+func (s *source) annotateall(err error) error {
+	switch x := err.(type) {
+	case *Error:
+		s.annotate(x)
+	case ErrorList:
+		for _, e := range x {
+			s.annotateall(e)
+		}
+	}
+	return err
+}
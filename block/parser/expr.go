@@ -0,0 +1,296 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// binop is an infix operator in expressions.
+type binop struct {
+	tok   string
+	typ   string // block type implementing the operator
+	prec  int
+	assoc bool // chains use a single block with more inputs
+}
+
+// longer tokens come first so they are matched before their prefixes
+var binops = []*binop{
+	{"||", "or", 1, true},
+	{"&&", "and", 2, true},
+	{"==", "eq", 3, false},
+	{"!=", "ne", 3, false},
+	{"<=", "le", 3, false},
+	{">=", "ge", 3, false},
+	{"<", "lt", 3, false},
+	{">", "gt", 3, false},
+	{"+", "add", 4, true},
+	{"-", "sub", 4, false},
+	{"*", "mul", 5, true},
+	{"/", "div", 5, false},
+	{"%", "mod", 5, false},
+}
+
+// expr parses an expression within parentheses. Operators are
+// turned into blocks, and the output of the last one is returned.
+func (p *parser) expr() specSource {
+	if !p.r.eatch('(') {
+		panic("'(' expected")
+	}
+	s := p.binary(1)
+	p.r.skipallspace()
+	if !p.r.eatch(')') {
+		panic("')' expected")
+	}
+	return s
+}
+
+// binary parses operands joined by operators having precedence prec or higher.
+func (p *parser) binary(prec int) specSource {
+	x := p.unary()
+	var (
+		last   *Blk // block of the last operator
+		lastop *binop
+		names  []string // input names of last
+		n      int      // inputs of last used
+	)
+	for {
+		p.r.skipallspace()
+		pos, lno := p.r.pos, p.r.sourceline()
+		op := p.binop()
+		if op == nil || op.prec < prec {
+			return x
+		}
+		p.r.pos += len(op.tok)
+		y := p.binary(op.prec + 1)
+		if op == lastop && op.assoc && n < len(names) {
+			p.link(&concreteblksink{lno, last, names[n]}, y)
+			n++
+			continue
+		}
+		last, names = p.opblk(pos, op.typ, 2)
+		p.link(&concreteblksink{lno, last, names[0]}, x)
+		p.link(&concreteblksink{lno, last, names[1]}, y)
+		x, lastop, n = &concreteblksource{lno, last, ""}, op, 2
+	}
+}
+
+// binop returns the operator next in the source, if any.
+func (p *parser) binop() *binop {
+	part := string(p.r.src[p.r.pos:])
+	for _, op := range binops {
+		if strings.HasPrefix(part, op.tok) {
+			return op
+		}
+	}
+	return nil
+}
+
+// unary parses an operand, with optional '!' or '-' operators before it.
+func (p *parser) unary() specSource {
+	p.r.skipallspace()
+	pos, lno := p.r.pos, p.r.sourceline()
+	switch {
+	case p.r.ch() == '(':
+		return p.expr()
+	case p.r.eatch('!'):
+		blk, names := p.opblk(pos, "not", 1)
+		p.link(&concreteblksink{lno, blk, names[0]}, p.unary())
+		return &concreteblksource{lno, blk, ""}
+	case p.r.ch() == '-' && !p.atnumber():
+		p.r.eatch('-')
+		blk, names := p.opblk(pos, "mul", 2)
+		p.link(&concreteblksink{lno, blk, names[0]}, p.unary())
+		p.link(&concreteblksink{lno, blk, names[1]}, &valueport{lno, constport{float64(-1)}})
+		return &concreteblksource{lno, blk, ""}
+	}
+	return p.parsesource()
+}
+
+// atnumber reports if a number is next in the source.
+func (p *parser) atnumber() bool {
+	t := *p.r
+	t.eatch('-')
+	return isdigit(t.ch()) || t.ch() == '.'
+}
+
+// opblk creates a block of type typ for an operator at pos.
+// The block must have at least n inputs, their names are returned.
+func (p *parser) opblk(pos int, typ string, n int) (*Blk, []string) {
+	t, err := p.GetType(typ)
+	if err != nil {
+		panic(p.src.errorat(pos, err))
+	}
+	names := t.Input(nil, nil).Names()
+	if len(names) < n {
+		panic(p.src.errorat(pos, errf("type '%s' has too few inputs for operator", typ)))
+	}
+	lno := p.r.sourceline()
+	blk := p.newblk(lno, fmt.Sprintf("«%s:%d»", typ, lno), typ, t, nil)
+	blk.oc = &outputconstraint{fmt.Sprintf("'%s' used as operator must have unnamed output", typ), []string{""}}
+	return blk, names
+}
+
+// value parses a parameter value. Values are strings, lists of numbers,
+// identifiers, or numbers computed from constants, def parameters and
+// config values. Names of constants stand for their values, other names
+// are identifiers. Spaces are allowed only within parentheses in
+// computations, so that values can be separated by spaces.
+func (p *parser) value() interface{} {
+	var v interface{}
+	switch ch := p.r.ch(); {
+	case ch == '"':
+		v = p.r.str()
+	case ch == '{':
+		v = p.list()
+	case isnamestart(ch) && !p.atcomputation():
+		n := p.r.name()
+		var ok bool
+		if v, ok = p.constant(n); !ok {
+			v = Ident(n)
+		}
+	default:
+		v = p.valexpr(false)
+	}
+	p.r.skiplinespace()
+	return v
+}
+
+// constvalue parses the value of a const statement,
+// allowing spaces in computations.
+func (p *parser) constvalue() interface{} {
+	p.r.skiplinespace()
+	switch p.r.ch() {
+	case '"', '{':
+		return p.value()
+	}
+	return p.valexpr(true)
+}
+
+// atcomputation reports if the name next in the source is followed by an operator.
+func (p *parser) atcomputation() bool {
+	t := *p.r
+	t.name()
+	return strings.ContainsRune("+-*/%", t.ch())
+}
+
+// list parses a list of numbers within braces.
+func (p *parser) list() []float64 {
+	if !p.r.eatch('{') {
+		panic("'{' expected")
+	}
+	v := []float64{}
+	for {
+		p.r.skipallspace()
+		if p.r.eatch('}') {
+			return v
+		}
+		v = append(v, p.valexpr(false))
+	}
+}
+
+// valexpr parses a sum of terms, allowing spaces between them if sp is true.
+func (p *parser) valexpr(sp bool) float64 {
+	v := p.valterm(sp)
+	for {
+		p.valspace(sp)
+		switch {
+		case p.r.eatch('+'):
+			v += p.valterm(sp)
+		case p.r.eatch('-'):
+			v -= p.valterm(sp)
+		default:
+			return v
+		}
+	}
+}
+
+func (p *parser) valterm(sp bool) float64 {
+	v := p.valfactor(sp)
+	for {
+		p.valspace(sp)
+		pos := p.r.pos
+		var op rune
+		switch {
+		case p.r.eatch('*'):
+			v *= p.valfactor(sp)
+			continue
+		case p.r.eatch('/'):
+			op = '/'
+		case p.r.eatch('%'):
+			op = '%'
+		default:
+			return v
+		}
+		d := p.valfactor(sp)
+		if d == 0 {
+			panic(p.src.errorat(pos, "division by zero"))
+		}
+		if op == '/' {
+			v /= d
+		} else {
+			v = math.Mod(v, d)
+		}
+	}
+}
+
+func (p *parser) valfactor(sp bool) float64 {
+	p.valspace(sp)
+	switch ch := p.r.ch(); {
+	case p.r.eatch('('):
+		v := p.valexpr(true)
+		if !p.r.eatch(')') {
+			panic("')' expected")
+		}
+		return v
+	case p.r.eatch('-'):
+		return -p.valfactor(sp)
+	case isnamestart(ch):
+		pos := p.r.pos
+		n := p.r.name()
+		v, ok := p.constant(n)
+		if !ok {
+			e := p.src.errorat(pos, errf("unknown value '%s'", n))
+			e.Hint = suggest(n, p.constnames())
+			panic(e)
+		}
+		x, ok := number(v)
+		if !ok {
+			panic(p.src.errorat(pos, errf("'%s' is not a number", n)))
+		}
+		return x
+	case isnumstart(ch):
+		return p.r.num()
+	}
+	panic("value expected")
+}
+
+func (p *parser) valspace(sp bool) {
+	if sp {
+		p.r.skiplinespace()
+	}
+}
+
+// constant returns the value of the constant or def parameter
+// called name, or the config value if there is none.
+func (p *parser) constant(name string) (interface{}, bool) {
+	if v, ok := p.lookup(name); ok {
+		return v, true
+	}
+	v, ok := p.config[name]
+	return v, ok
+}
+
+// constnames returns the names constant can look up.
+func (p *parser) constnames() []string {
+	var v []string
+	for s := p.scope; s != nil; s = s.parent {
+		for n := range s.values {
+			v = append(v, n)
+		}
+	}
+	for n := range p.config {
+		v = append(v, n)
+	}
+	return v
+}
@@ -0,0 +1,463 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	gosort "sort"
+	"strconv"
+	"strings"
+)
+
+// Format returns src in canonical form. Statements are put on lines of
+// their own, indented within def, for and layer statements and groups,
+// with spaces between tokens normalized. Sources of consecutive conn
+// statements and their comments are aligned, and numbers having SI
+// prefixes are written using the prefix best suited for their value.
+// Comments are kept. Only the structure of statements is checked, for
+// matching brackets and terminated strings, their contents are not.
+func Format(src []byte) ([]byte, error) {
+	s := &source{src: src}
+	v, err := syntax(s)
+	if err != nil {
+		return nil, s.annotateall(err.(ErrorList))
+	}
+	f := new(formatter)
+	f.stmts(v, 0)
+	return f.bytes(), nil
+}
+
+// line is a line of formatted source.
+type line struct {
+	indent  int
+	text    string
+	comment string
+	head    int  // length of the sink of conn statements
+	blank   bool // preceded by an empty line
+	stmt    bool // not a comment line
+}
+
+type formatter struct {
+	lines []*line
+}
+
+func (f *formatter) add(l *line) {
+	if len(f.lines) == 0 {
+		l.blank = false
+	}
+	f.lines = append(f.lines, l)
+}
+
+// stmts adds lines for v at depth. Bodies of def, for and layer statements
+// are indented, sections of if statements are not.
+func (f *formatter) stmts(v []*stmt, depth int) {
+	var open []bool // statements open, and if their bodies are indented
+	indent := func() int {
+		n := depth
+		for _, x := range open {
+			if x {
+				n++
+			}
+		}
+		return n
+	}
+	for _, st := range v {
+		if len(st.toks) == 0 {
+			f.add(&line{indent: indent(), text: st.comment, blank: st.blank})
+			continue
+		}
+		kw := st.keyword()
+		if kw == "end" && len(open) != 0 {
+			open = open[:len(open)-1]
+		}
+		l := &line{indent: indent(), text: tokstring(st.toks), comment: st.comment, blank: st.blank, stmt: true}
+		if kw == "conn" && len(st.toks) > 2 {
+			l.head = len(tokstring(st.toks[:2]))
+		}
+		f.add(l)
+		if st.group {
+			f.stmts(st.body, l.indent+1)
+			f.add(&line{indent: l.indent, text: "}", comment: st.endcomment, stmt: true})
+		}
+		switch kw {
+		case "def", "for", "layer":
+			open = append(open, true)
+		case "if":
+			open = append(open, false)
+		}
+	}
+}
+
+// bytes returns the source of the lines, with conn statements
+// and comments aligned.
+func (f *formatter) bytes() []byte {
+	// runs of lines to align, broken by empty and comment lines
+	run := func(i int, ok func(*line) bool) int {
+		j := i + 1
+		for j < len(f.lines) && !f.lines[j].blank && f.lines[j].indent == f.lines[i].indent && ok(f.lines[j]) {
+			j++
+		}
+		return j
+	}
+	isconn := func(l *line) bool { return l.stmt && l.head != 0 }
+	for i := 0; i < len(f.lines); {
+		if !isconn(f.lines[i]) {
+			i++
+			continue
+		}
+		j := run(i, isconn)
+		w := 0
+		for _, l := range f.lines[i:j] {
+			if l.head > w {
+				w = l.head
+			}
+		}
+		for _, l := range f.lines[i:j] {
+			l.text = l.text[:l.head] + strings.Repeat(" ", w-l.head) + l.text[l.head:]
+		}
+		i = j
+	}
+	hascomment := func(l *line) bool { return l.stmt && l.comment != "" }
+	for i := 0; i < len(f.lines); {
+		if !hascomment(f.lines[i]) {
+			i++
+			continue
+		}
+		j := run(i, hascomment)
+		w := 0
+		for _, l := range f.lines[i:j] {
+			if n := len(l.text); n > w {
+				w = n
+			}
+		}
+		for _, l := range f.lines[i:j] {
+			l.text += strings.Repeat(" ", w-len(l.text))
+		}
+		i = j
+	}
+
+	buf := new(bytes.Buffer)
+	for _, l := range f.lines {
+		if l.blank {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(strings.Repeat("\t", l.indent))
+		buf.WriteString(l.text)
+		if l.stmt && l.comment != "" {
+			buf.WriteString(" " + l.comment)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// tokstring returns the tokens of a statement separated by single spaces
+// where there was space between them, except within brackets, before
+// commas and around colons within blocks, where spacing is normalized.
+// Names of group braces are kept on the line of the opening brace.
+func tokstring(v []*token) string {
+	var buf bytes.Buffer
+	var open []string
+	for i, t := range v {
+		sp := t.sp && i != 0
+		var prev string
+		if i != 0 && v[i-1].kind == top {
+			prev = v[i-1].text
+		}
+		inblk := len(open) != 0 && open[len(open)-1] == "["
+		switch {
+		case i == 3 && prev == "{" && v[0].text == "block":
+			// names of group braces
+		case t.kind == top && (t.text == "]" || t.text == ")" || t.text == "}"):
+			sp = false
+		case prev == "[" || prev == "(" || prev == "{":
+			sp = false
+		case t.kind == top && (t.text == "," || t.text == ":" && inblk):
+			sp = false
+		case prev == "," || prev == ":" && inblk:
+			sp = true
+		}
+		if sp {
+			buf.WriteByte(' ')
+		}
+		if t.kind == tnumber {
+			buf.WriteString(fmtnumber(t.text))
+		} else {
+			buf.WriteString(t.text)
+		}
+		if t.kind == top {
+			switch t.text {
+			case "[", "(", "{":
+				open = append(open, t.text)
+			case "]", ")", "}":
+				if len(open) != 0 {
+					open = open[:len(open)-1]
+				}
+			}
+		}
+	}
+	return buf.String()
+}
+
+// fmtnumber returns the number s in canonical form. Numbers having SI
+// prefixes get the prefix that leaves from 1 to 999 before the decimal
+// point where possible, other numbers are written without prefix.
+// Leading and trailing zeros are removed.
+func fmtnumber(s string) string {
+	var digits []byte
+	exp := 0 // s is digits * 10^exp
+	frac := false
+	prefixed := false
+	for _, ch := range s {
+		switch {
+		case isdigit(ch):
+			digits = append(digits, byte(ch))
+			if frac {
+				exp--
+			}
+		case ch == '.':
+			frac = true
+		default:
+			exp += siprefix(ch)
+			prefixed = true
+		}
+	}
+	for len(digits) != 0 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	for len(digits) != 0 && digits[len(digits)-1] == '0' {
+		digits = digits[:len(digits)-1]
+		exp++
+	}
+	if len(digits) == 0 {
+		return "0"
+	}
+	if !prefixed {
+		return decimal(digits, exp)
+	}
+	mag := len(digits) + exp - 1 // position of the first digit
+	for _, p := range []struct {
+		exp    int
+		prefix string
+	}{{3, "k"}, {0, ""}, {-3, "m"}, {-6, "u"}, {-9, "n"}} {
+		if mag >= p.exp || p.exp == -9 {
+			return decimal(digits, exp-p.exp) + p.prefix
+		}
+	}
+	panic("not reached")
+}
+
+// decimal returns digits * 10^exp in decimal notation.
+func decimal(digits []byte, exp int) string {
+	if exp >= 0 {
+		return string(digits) + strings.Repeat("0", exp)
+	}
+	n := len(digits) + exp // digits before the decimal point
+	if n > 0 {
+		return string(digits[:n]) + "." + string(digits[n:])
+	}
+	return "0." + strings.Repeat("0", -n) + string(digits)
+}
+
+// FormatProfile returns source for p in the form of Format, so that profiles
+// built by programs can be saved. Blocks are written in order of their names,
+// blocks having names not valid in sources are renamed. The Type of each
+// block must be set up in the TypeMap the source is parsed with using the
+// TypeName of the block.
+func FormatProfile(p *Profile) ([]byte, error) {
+	names := blocknames(p.Blocks)
+	blks := append([]*Blk(nil), p.Blocks...)
+	gosort.Slice(blks, func(i, j int) bool { return names[blks[i]] < names[blks[j]] })
+
+	buf := new(bytes.Buffer)
+	if len(p.Config) != 0 {
+		s, err := paramstring(p.Config)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(buf, "set %s\n\n", s)
+	}
+	for _, b := range blks {
+		if b.TypeName == "" {
+			return nil, errf("block '%s' has no type name", b.Name)
+		}
+		fmt.Fprintf(buf, "block %s [%s", names[b], b.TypeName)
+		if b.Param != nil {
+			s, err := paramstring(b.Param)
+			if err != nil {
+				return nil, errf("block '%s': %v", b.Name, err)
+			}
+			if s != "" {
+				buf.WriteString(": " + s)
+			}
+		}
+		buf.WriteString("]\n")
+	}
+	for _, b := range blks {
+		sels := make([]string, 0, len(b.Inputs))
+		for sel := range b.Inputs {
+			sels = append(sels, sel)
+		}
+		gosort.Slice(sels, func(i, j int) bool { return portless(sels[i], sels[j]) })
+		if len(sels) != 0 {
+			buf.WriteByte('\n')
+		}
+		for _, sel := range sels {
+			k := names[b]
+			if sel != "" {
+				k += "." + sel
+			}
+			var s string
+			switch x := b.Inputs[sel].(type) {
+			case *BlkPortSource:
+				n, ok := names[x.Blk]
+				if !ok {
+					return nil, errf("block '%s' has input from block '%s' not in profile", b.Name, x.Blk.Name)
+				}
+				s = n
+				if x.Sel != "" {
+					s += "." + x.Sel
+				}
+			case *ValueSource:
+				var err error
+				if s, err = valuestring(x.Value); err != nil {
+					return nil, errf("block '%s': %v", b.Name, err)
+				}
+			default:
+				return nil, errf("block '%s' has input of unknown kind %T", b.Name, x)
+			}
+			fmt.Fprintf(buf, "conn %s %s\n", k, s)
+		}
+	}
+	return Format(buf.Bytes())
+}
+
+// blocknames returns names of blks valid in sources. Names not valid are
+// changed to valid ones not used by other blocks.
+func blocknames(blks []*Blk) map[*Blk]string {
+	m := make(map[*Blk]string)
+	used := make(map[string]bool)
+	for _, b := range blks {
+		if validname(b.Name) && !used[b.Name] {
+			m[b], used[b.Name] = b.Name, true
+		}
+	}
+	for _, b := range blks {
+		if _, ok := m[b]; ok {
+			continue
+		}
+		var buf []rune
+		for _, ch := range b.Name {
+			switch {
+			case isnamepart(ch):
+				buf = append(buf, ch)
+			case len(buf) != 0 && buf[len(buf)-1] != '_':
+				buf = append(buf, '_')
+			}
+		}
+		n := strings.TrimRight(string(buf), "_")
+		if n == "" || !isnamestart(rune(n[0])) {
+			n = "b_" + n
+		}
+		if !validname(n) {
+			n += "_"
+		}
+		x := n
+		for i := 2; used[x]; i++ {
+			x = fmt.Sprintf("%s_%d", n, i)
+		}
+		m[b], used[x] = x, true
+	}
+	return m
+}
+
+// validname reports if n can be used as a block name in sources.
+func validname(n string) bool {
+	for i, ch := range n {
+		if i == 0 && !isnamestart(ch) || !isnamepart(ch) {
+			return false
+		}
+	}
+	if _, ok := newcontext(nil).portNames[n]; ok {
+		return false
+	}
+	return n != "" && !iskeyword(n)
+}
+
+// iskeyword reports if n starts statements.
+func iskeyword(n string) bool {
+	r := &sourcereader{src: []byte(n)}
+	return r.atstatement()
+}
+
+// portless sorts unnamed ports first, and numbered ports in numeric order.
+func portless(a, b string) bool {
+	x, xerr := strconv.Atoi(a)
+	y, yerr := strconv.Atoi(b)
+	if xerr == nil && yerr == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// paramstring returns p as an argument list.
+func paramstring(p Param) (string, error) {
+	var v []string
+	switch x := p.(type) {
+	case PosParam:
+		for _, a := range x {
+			s, err := valuestring(a)
+			if err != nil {
+				return "", err
+			}
+			v = append(v, s)
+		}
+	case NamedParam:
+		for _, n := range sortedkeys(x) {
+			s, err := valuestring(x[n])
+			if err != nil {
+				return "", err
+			}
+			v = append(v, n+"="+s)
+		}
+	default:
+		return "", errf("parameters of unknown kind %T", p)
+	}
+	return strings.Join(v, " "), nil
+}
+
+// valuestring returns v as it is written in sources.
+func valuestring(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return "on", nil
+		}
+		return "off", nil
+	case int:
+		for _, h := range []struct {
+			v int
+			n string
+		}{{hatC, "centre"}, {hatN, "north"}, {hatE, "east"}, {hatS, "south"}, {hatW, "west"}} {
+			if x == h.v {
+				return h.n, nil
+			}
+		}
+		return "", errf("hat value %d has no name", x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	case string:
+		if strings.ContainsAny(x, "\"\n") {
+			return "", errf("string %q can't be written", x)
+		}
+		return `"` + x + `"`, nil
+	case Ident:
+		return string(x), nil
+	case []float64:
+		var v []string
+		for _, f := range x {
+			v = append(v, strconv.FormatFloat(f, 'f', -1, 64))
+		}
+		return "{" + strings.Join(v, " ") + "}", nil
+	}
+	return "", errf("value %v of unknown kind %T", v, v)
+}
@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
+	"path/filepath"
 )
 
 // Profile is a set of Blks ordered.
@@ -10,48 +12,88 @@ import (
 type Profile struct {
 	Config NamedParam // parameters from set statements
 	Blocks []*Blk     // slice of all Blks found in source
+	Files  []string   // files included
 }
 
-func Parse(src string, tm TypeMap) (*Profile, error) {
+// Parse parses src. Values in defs are set before parsing, and
+// override values of set statements. Errors are reported as an ErrorList
+// having an *Error for each problem found.
+func Parse(src string, tm TypeMap, defs NamedParam) (*Profile, error) {
 	data := []byte(src)
-	return read(data, tm)
+	return read("", data, tm, defs)
 }
 
-func ReadProfile(r io.Reader, tm TypeMap) (*Profile, error) {
+func ReadProfile(r io.Reader, tm TypeMap, defs NamedParam) (*Profile, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	return read(data, tm)
+	return read("", data, tm, defs)
 }
 
-func LoadProfile(fn string, tm TypeMap) (*Profile, error) {
+func LoadProfile(fn string, tm TypeMap, defs NamedParam) (*Profile, error) {
 	data, err := ioutil.ReadFile(fn)
 	if err != nil {
 		return nil, err
 	}
-	return read(data, tm)
+	return read(fn, data, tm, defs)
 }
 
-func read(data []byte, tm TypeMap) (*Profile, error) {
+func read(name string, data []byte, tm TypeMap, defs NamedParam) (*Profile, error) {
+	p, err := parseprofile(name, data, tm, defs)
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{p.config, p.vblk, p.files}, nil
+}
+
+// parseprofile parses and sorts the config data from file name.
+func parseprofile(name string, data []byte, tm TypeMap, defs NamedParam) (*parser, error) {
 	p := newparser(tm)
+	for n, v := range defs {
+		p.config[n] = v
+	}
+	p.defines = defs
+	p.src = &source{name: name, src: data}
+	if name != "" {
+		p.src.abs, _ = filepath.Abs(name)
+	}
+	// sort even after parse errors to report as many problems as possible
+	var errs ErrorList
 	if err := p.parse(data); err != nil {
-		return nil, err
+		errs = append(errs, err.(ErrorList)...)
 	}
 	if err := sort(p.context); err != nil {
-		return nil, err
+		errs = append(errs, err.(ErrorList)...)
+	}
+	if len(errs) != 0 {
+		errs.sortbyline()
+		return nil, p.src.annotateall(errs.unique())
 	}
-	return &Profile{p.context.config, p.context.vblk}, nil
+	return p, nil
 }
 
 // Blk is the working unit in a Profile.
 type Blk struct {
-	Name   string
-	Type   Type
-	Param  Param
-	Inputs map[string]Source
+	Name     string
+	File     string // source file of the definition, if any
+	Line     int    // source line of the definition
+	TypeName string // name of Type in the TypeMap
+	Type     Type
+	Param    Param
+	Inputs   map[string]Source
 
-	oc *outputconstraint
+	oc  *outputconstraint
+	src *source
+
+	// globals are set when the parameters of the Blk are found valid,
+	// ports are reported for its parameters only after that
+	globals NamedParam
+	paramok bool
+
+	// looptype is the type of the output of a delay while it is checked,
+	// if its input is tried for another type than it was given
+	looptype PortType
 }
 
 func (b *Blk) SetInput(name string, src Source) error {
@@ -65,11 +107,51 @@ func (b *Blk) SetInput(name string, src Source) error {
 	return nil
 }
 
+// Errorf returns an *Error for the definition of b formatted with fmt.Sprintf.
+func (b *Blk) Errorf(f string, v ...interface{}) *Error {
+	e := &Error{File: b.File, Line: b.Line, Msg: fmt.Sprintf(f, v...)}
+	if b.src != nil {
+		b.src.annotate(e)
+	}
+	return e
+}
+
 func (b *Blk) port(sel string) (*Blk, string, error) { return b, sel, nil }
 
+// param returns the parameters of b to be used for its ports.
+func (b *Blk) param() Param {
+	if !b.paramok {
+		return nil
+	}
+	if b.Param == nil {
+		return PosParam(nil)
+	}
+	return b.Param
+}
+
+// delayed reports if b is a delay that may be used in loops.
+func (b *Blk) delayed() bool {
+	d, ok := b.Type.(Delayer)
+	return ok && d.Delayed()
+}
+
+// stateful reports if b has state, such as delays.
+func (b *Blk) stateful() bool {
+	s, ok := b.Type.(Stateful)
+	return b.delayed() || (ok && s.Stateful())
+}
+
+// inputs returns the inputs of b.
+func (b *Blk) inputs() PortMap { return b.Type.Input(b.param(), b.globals) }
+
+// outputs returns the outputs of b for input im.
+func (b *Blk) outputs(im PortMap) (PortMap, error) {
+	return b.Type.Output(b.param(), b.globals, im)
+}
+
 func (b *Blk) InputMap() (PortMap, error) {
 	var pm PortMap
-	for _, p := range b.Type.Input() {
+	for _, p := range b.inputs() {
 		if input := b.Inputs[p.Name]; input != nil {
 			pt, err := input.Type()
 			if err != nil {
@@ -96,7 +178,7 @@ func PortStr(p PortType) string {
 	case Bool:
 		return "bool"
 	case Scalar:
-		return "scalar"
+		return "axis"
 	case Hat:
 		return "hat"
 	case Any:
@@ -152,11 +234,19 @@ type BlkPortSource struct {
 }
 
 func (s *BlkPortSource) Type() (PortType, error) {
-	im, err := s.Blk.InputMap()
-	if err != nil {
-		return Invalid, err
+	if s.Blk.looptype != Invalid {
+		return s.Blk.looptype, nil
 	}
-	om, err := s.Blk.Type.Output(im)
+	var im PortMap
+	if !s.Blk.delayed() {
+		// outputs of delays don't depend on their inputs,
+		// which may be within a loop leading back here
+		var err error
+		if im, err = s.Blk.InputMap(); err != nil {
+			return Invalid, err
+		}
+	}
+	om, err := s.Blk.outputs(im)
 	if err != nil {
 		return Invalid, err
 	}
@@ -199,16 +289,45 @@ func (s *ValueSource) Type() (PortType, error) {
 // Blocks must normally have all their inputs connected, except if MustHaveInput of their Type
 // returns false.
 type Type interface {
-	// Input reports inputs settable for Blks of this Type
-	Input() PortMap
+	// Input reports inputs settable for Blks of this Type having parameters p.
+	// If p is nil, all inputs Blks of this Type may have are reported.
+	Input(p Param, globals NamedParam) PortMap
 
-	// Output returns outputs provided by Blks of this Type for given input
-	Output(input PortMap) (PortMap, error)
+	// Output returns outputs provided by Blks of this Type for
+	// given parameters and input. A nil p is handled like in Input.
+	Output(p Param, globals NamedParam, input PortMap) (PortMap, error)
 
 	// Param validates input parameters
 	Param(p Param, globals NamedParam) error
 }
 
+// ParamLister is implemented by Types that can list the names of their
+// parameters. Named parameters not in the list are rejected.
+type ParamLister interface {
+	ParamNames() []string
+}
+
+// OutputLister is implemented by Types that can list the names of the
+// outputs of their Blks without knowing their inputs. Outputs of such
+// Types may be referred to using wildcards in map statements.
+type OutputLister interface {
+	OutputNames(p Param, globals NamedParam) []string
+}
+
+// Delayer is implemented by Types of blocks that output the values their
+// inputs had in the previous tick. Such blocks are sorted before the blocks
+// providing their input, so links may form loops through them. Their output
+// types must not depend on their inputs.
+type Delayer interface {
+	Delayed() bool
+}
+
+// Stateful is implemented by Types of blocks having state,
+// whose outputs may change while their inputs don't.
+type Stateful interface {
+	Stateful() bool
+}
+
 // Namespace knows the types available for a Profile.
 type TypeMap interface {
 	GetType(n string) (Type, error)
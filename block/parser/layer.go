@@ -0,0 +1,249 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// layer is a modifier state declared by a layer statement. Inputs connected
+// within the bodies of layer statements are set only while the layer is active.
+type layer struct {
+	name string
+	mods []modifier
+	cond specSource // on while the layer is active
+}
+
+// modifier is a bool source that must be on, or off if neg is set,
+// for a layer to be active.
+type modifier struct {
+	key string // name and selector of the source
+	neg bool
+	s   specSource
+}
+
+// exclusive reports if l and m can't be active at the same time, because
+// they need the same modifier in different states.
+func (l *layer) exclusive(m *layer) bool {
+	for _, a := range l.mods {
+		for _, b := range m.mods {
+			if a.key == b.key && a.neg != b.neg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parselayer parses a layer statement starting at pos, and the statements
+// of its body up to the matching end. Layers are declared with the modifiers
+// following their name, and may have their bodies continued in later layer
+// statements having no modifiers.
+func (p *parser) parselayer(pos int) {
+	l := p.layerheader(pos)
+	p.layer = l
+	defer func() {
+		p.layer = nil
+	}()
+	p.parsebody(pos, "layer")
+	p.r.eat("end")
+	p.r.endstatement()
+}
+
+// layerheader parses the header of the layer statement at pos,
+// and returns the layer it declares or continues.
+func (p *parser) layerheader(pos int) *layer {
+	defer p.recoverheader(pos, "layer")
+	if p.layer != nil {
+		panic(errf("layer within layer '%s'", p.layer.name))
+	}
+	p.r.skiplinespace()
+	npos := p.r.pos
+	name := p.r.name()
+	var mods []modifier
+	for {
+		p.r.skiplinespace()
+		if ch := p.r.ch(); p.r.eof() || ch == '\n' || ch == ';' || ch == '#' {
+			break
+		}
+		mpos := p.r.pos
+		neg := p.r.eatch('!')
+		n, sel := p.r.spec()
+		m := modifier{n, neg, p.nsource(mpos, n, sel)}
+		if sel != "" {
+			m.key += "." + sel
+		}
+		for _, x := range mods {
+			if x.key == m.key {
+				panic(p.src.errorat(mpos, errf("modifier '%s' used twice", m.key)))
+			}
+		}
+		mods = append(mods, m)
+	}
+
+	l, ok := p.layers[p.prefix+name]
+	switch {
+	case ok && len(mods) != 0:
+		panic(p.src.errorat(npos, errf("duplicate layer '%s'", name)))
+	case !ok && len(mods) == 0:
+		panic(p.src.errorat(npos, errf("layer '%s' needs modifiers", name)))
+	case !ok:
+		if p.defined(name) {
+			panic(p.src.errorat(npos, errf("duplicate name '%s'", name)))
+		}
+		l = &layer{name: name, mods: mods, cond: p.layercond(mods)}
+		p.layers[p.prefix+name] = l
+		p.portNames[name] = l.cond
+	}
+	p.r.endstatement()
+	return l
+}
+
+// layercond returns a source that is on when all modifiers in mods are in
+// the state they need to be, using not and and blocks.
+func (p *parser) layercond(mods []modifier) specSource {
+	lno := p.r.sourceline()
+	var x specSource
+	for _, m := range mods {
+		s := m.s
+		if m.neg {
+			blk, names := p.opblk(m.s.(*namedsource).pos, "not", 1)
+			p.link(&concreteblksink{lno, blk, names[0]}, s)
+			s = &concreteblksource{lno, blk, ""}
+		}
+		if x == nil {
+			x = s
+			continue
+		}
+		blk, names := p.opblk(m.s.(*namedsource).pos, "and", 2)
+		p.link(&concreteblksink{lno, blk, names[0]}, x)
+		p.link(&concreteblksink{lno, blk, names[1]}, s)
+		x = &concreteblksource{lno, blk, ""}
+	}
+	return x
+}
+
+// layered are the links of statements in layers setting the same input.
+type layered struct {
+	k    *namedsink
+	base *Link // link outside layers, if any
+	v    []Link
+}
+
+// mux replaces links setting inputs within layers with links to if blocks
+// selecting the source of the active layer. The link of the input outside
+// layers is used when no layer is active, or the zero value of the input
+// if there is none. Layers setting the same input must be exclusive.
+func mux(ctx *context, links []Link) ([]Link, error) {
+	var errs ErrorList
+	m := make(map[string]*layered)
+	var keys []string
+	key := func(k *namedsink) string {
+		return fmt.Sprintf("%p %s.%s", k.scope, k.name, k.sel)
+	}
+	for _, c := range links {
+		if k, ok := c.sink.(*namedsink); ok && c.layer != nil {
+			n := key(k)
+			x := m[n]
+			if x == nil {
+				x = &layered{k: k}
+				m[n] = x
+				keys = append(keys, n)
+			}
+			for _, o := range x.v {
+				if o.layer == c.layer {
+					errs = append(errs, k.src.errorat(k.pos, errf("%s of '%s' set twice in layer '%s'",
+						nice(inport, k.sel), k.name, c.layer.name)))
+				} else if !o.layer.exclusive(c.layer) {
+					errs = append(errs, k.src.errorat(k.pos, errf("layers '%s' and '%s' may both set %s of '%s' at once",
+						o.layer.name, c.layer.name, nice(inport, k.sel), k.name)))
+				}
+			}
+			x.v = append(x.v, c)
+		}
+	}
+	if len(m) == 0 {
+		return links, nil
+	}
+
+	var v []Link
+	for _, c := range links {
+		if k, ok := c.sink.(*namedsink); ok {
+			if x := m[key(k)]; x != nil {
+				if c.layer == nil {
+					if x.base != nil {
+						errs = append(errs, c.error(errf("%s of '%s' connected twice", nice(inport, k.sel), k.name)))
+					}
+					c := c
+					x.base = &c
+				}
+				continue
+			}
+		}
+		v = append(v, c)
+	}
+	t, err := ctx.GetType("if")
+	if err != nil {
+		return links, append(errs, err)
+	}
+	names := t.Input(nil, nil).Names()
+	for _, n := range keys {
+		x := m[n]
+		var s specSource = &layerdefault{x.k}
+		if x.base != nil {
+			s = x.base.source
+		}
+		for _, c := range x.v {
+			k := c.sink.(*namedsink)
+			blk := &Blk{
+				Name:     fmt.Sprintf("«layer %s:%d»", c.layer.name, k.lno),
+				File:     c.src.name,
+				Line:     k.lno,
+				TypeName: "if",
+				Type:     t,
+				src:      c.src,
+				oc:       &outputconstraint{"'if' used for layers must have unnamed output", []string{""}},
+			}
+			if err := checkparam(blk, ctx.config); err != nil {
+				return links, append(errs, err)
+			}
+			blk.globals, blk.paramok = ctx.config, true
+			ctx.vblk = append(ctx.vblk, blk)
+			v = append(v,
+				Link{&concreteblksink{k.lno, blk, names[0]}, c.layer.cond, c.src, nil},
+				Link{&concreteblksink{k.lno, blk, names[1]}, c.source, c.src, nil},
+				Link{&concreteblksink{k.lno, blk, names[2]}, s, c.src, nil})
+			s = &concreteblksource{k.lno, blk, ""}
+		}
+		c := x.v[len(x.v)-1]
+		v = append(v, Link{x.k, s, c.src, nil})
+	}
+	if len(errs) != 0 {
+		return v, errs
+	}
+	return v, nil
+}
+
+// layerdefault is the zero value of the input of k, used
+// when no layer setting it is active.
+type layerdefault struct {
+	k *namedsink
+}
+
+func (d *layerdefault) Blk(*context) (*Blk, error) { return nil, nil }
+
+func (d *layerdefault) Source(c *context) (Source, error) {
+	pm, _ := d.k.scope.sink(d.k.name)
+	blk, sel, err := d.k.resolve(pm, true)
+	if err != nil {
+		return nil, err
+	}
+	switch blk.inputs().Port(sel) {
+	case Bool:
+		return Value(false)
+	case Scalar:
+		return Value(float64(0))
+	case Hat:
+		return Value(hatC)
+	}
+	return nil, d.k.src.errorat(d.k.pos, errf("%s of block '%s' has no default for layers, set it outside layers",
+		nice(inport, sel), blk.Name))
+}
@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Lint loads the config file fn like LoadProfile, and reports problems
+// that don't prevent it from working, but are likely mistakes:
+//
+//   - blocks whose outputs never reach a sink
+//   - inputs of sinks not connected, such as vjoy ports
+//   - ports declared but not used
+//   - parameters given positionally that are also set by set statements
+//   - if blocks having the same source for both branches
+//   - if blocks having constant conditions
+//
+// Warnings are reported as an ErrorList, errors loading the config
+// are returned like by LoadProfile.
+func Lint(fn string, tm TypeMap, defs NamedParam) (ErrorList, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parseprofile(fn, data, tm, defs)
+	if err != nil {
+		return nil, err
+	}
+	return lint(p.context), nil
+}
+
+func lint(ctx *context) ErrorList {
+	var warns ErrorList
+
+	// blocks using the outputs of blocks
+	users := make(map[*Blk][]*Blk)
+	for _, blk := range ctx.vblk {
+		for _, s := range blk.Inputs {
+			if ps, ok := s.(*BlkPortSource); ok {
+				users[ps.Blk] = append(users[ps.Blk], blk)
+			}
+		}
+	}
+
+	// sinks are blocks without outputs, others are live if they
+	// have outputs reaching a sink
+	live := make(map[*Blk]bool)
+	var mark func(blk *Blk)
+	mark = func(blk *Blk) {
+		if live[blk] {
+			return
+		}
+		live[blk] = true
+		for _, s := range blk.Inputs {
+			if ps, ok := s.(*BlkPortSource); ok {
+				mark(ps.Blk)
+			}
+		}
+	}
+	var sinks []*Blk
+	for _, blk := range ctx.vblk {
+		if issink(blk) {
+			sinks = append(sinks, blk)
+			mark(blk)
+		}
+	}
+	for _, blk := range ctx.vblk {
+		if !live[blk] && !generated(blk.Name) {
+			if len(users[blk]) == 0 {
+				warns = append(warns, blk.Errorf("block '%s' not used", blk.Name))
+			} else {
+				warns = append(warns, blk.Errorf("outputs of block '%s' never reach a sink", blk.Name))
+			}
+		}
+	}
+
+	for _, blk := range sinks {
+		var v []string
+		for _, n := range blk.inputs().Names() {
+			if _, ok := blk.Inputs[n]; !ok {
+				v = append(v, n)
+			}
+		}
+		if len(v) != 0 {
+			warns = append(warns, blk.Errorf("block '%s' has inputs not connected: %s", blk.Name, portranges(v)))
+		}
+	}
+
+	// ports of def instances are used if they are used in any of them
+	posused := make(map[string]bool)
+	for _, a := range ctx.aliases {
+		if ctx.used[a.s] {
+			posused[aliaspos(a)] = true
+		}
+	}
+	for _, a := range ctx.aliases {
+		if !posused[aliaspos(a)] {
+			warns = append(warns, a.s.src.errorat(a.s.pos, errf("port '%s' not used", a.name)))
+		}
+	}
+
+	for _, blk := range ctx.vblk {
+		for _, n := range posnames(blk, ctx.config) {
+			if ctx.sets[n] {
+				warns = append(warns, blk.Errorf("block '%s' has parameter '%s' given by position, hiding the value of set", blk.Name, n))
+			}
+		}
+	}
+
+	if t, err := ctx.GetType("if"); err == nil {
+		names := t.Input(nil, nil).Names()
+		memo := make(map[*Blk]bool)
+		for _, blk := range ctx.vblk {
+			if blk.TypeName != "if" || len(names) < 3 {
+				continue
+			}
+			if samesource(blk.Inputs[names[1]], blk.Inputs[names[2]]) {
+				warns = append(warns, blk.Errorf("block '%s' has the same source for both branches", blk.Name))
+			}
+			if c := blk.Inputs[names[0]]; c != nil && constant(c, memo) {
+				warns = append(warns, blk.Errorf("block '%s' has constant condition", blk.Name))
+			}
+		}
+	}
+
+	warns.sortbyline()
+	return warns.unique()
+}
+
+// issink reports if blk has no outputs.
+func issink(blk *Blk) bool {
+	im, err := blk.InputMap()
+	if err != nil {
+		return false
+	}
+	om, err := blk.outputs(im)
+	return err == nil && len(om) == 0
+}
+
+// generated reports if n is the name of a block created for an
+// expression or block given inline, or an element of a group.
+func generated(n string) bool {
+	return strings.ContainsAny(n, "«#")
+}
+
+// aliaspos returns the position of the port statement of a,
+// with the name it declared.
+func aliaspos(a alias) string {
+	return a.s.src.name + ":" + strconv.Itoa(a.s.pos) + ":" + a.name
+}
+
+// portranges returns the port names in v, with numbered
+// ports in a row written as ranges, like hat1..4.
+func portranges(v []string) string {
+	var r []string
+	for i := 0; i < len(v); {
+		prefix, n, ok := numbered(v[i])
+		j := i + 1
+		for ok && j < len(v) {
+			p, m, isnum := numbered(v[j])
+			if !isnum || p != prefix || m != n+j-i {
+				break
+			}
+			j++
+		}
+		if j-i > 1 {
+			r = append(r, v[i]+".."+strconv.Itoa(n+j-i-1))
+		} else {
+			r = append(r, v[i])
+		}
+		i = j
+	}
+	return strings.Join(r, " ")
+}
+
+// numbered splits n into a prefix and a number.
+func numbered(n string) (string, int, bool) {
+	i := strings.LastIndexFunc(n, func(ch rune) bool { return !isdigit(ch) }) + 1
+	x, err := strconv.Atoi(n[i:])
+	return n[:i], x, err == nil
+}
+
+// posnames returns the names of parameters blk has given by position.
+func posnames(blk *Blk, config NamedParam) []string {
+	p, ok := blk.Param.(PosParam)
+	if !ok || len(p) == 0 {
+		return nil
+	}
+	r := &recparam{v: p}
+	blk.Type.Param(r, config)
+	return r.names
+}
+
+// recparam is a positional argument list that records
+// the names of the arguments read.
+type recparam struct {
+	v     PosParam
+	names []string
+}
+
+func (r *recparam) args() argsource { return &recargs{posargs{v: r.v}, r} }
+
+type recargs struct {
+	posargs
+	r *recparam
+}
+
+func (a *recargs) arg(n string) (interface{}, bool) {
+	v, ok := a.posargs.arg(n)
+	if ok && !has(a.r.names, n) {
+		a.r.names = append(a.r.names, n)
+	}
+	return v, ok
+}
+
+// samesource reports if a and b are the same output or value.
+func samesource(a, b Source) bool {
+	switch x := a.(type) {
+	case *BlkPortSource:
+		y, ok := b.(*BlkPortSource)
+		return ok && x.Blk == y.Blk && x.Sel == y.Sel
+	case *ValueSource:
+		y, ok := b.(*ValueSource)
+		return ok && x.Value == y.Value
+	}
+	return false
+}
+
+// constant reports if s is a value, or the output of a block having
+// inputs all of which are constant. Blocks without inputs, such as
+// those of devices, and blocks having state are not constant.
+func constant(s Source, memo map[*Blk]bool) bool {
+	switch x := s.(type) {
+	case *ValueSource:
+		return true
+	case *BlkPortSource:
+		c, ok := memo[x.Blk]
+		if ok {
+			return c
+		}
+		memo[x.Blk] = false
+		c = len(x.Blk.Inputs) != 0 && !x.Blk.stateful()
+		for _, in := range x.Blk.Inputs {
+			if !constant(in, memo) {
+				c = false
+				break
+			}
+		}
+		memo[x.Blk] = c
+		return c
+	}
+	return false
+}
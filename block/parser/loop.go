@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"math"
+	"strconv"
+)
+
+// loopvar is a variable of a for statement with its values.
+type loopvar struct {
+	name string
+	v    []interface{}
+}
+
+// parsefor parses a for statement starting at pos, and parses
+// its body up to the matching end once for each value of its
+// variables. Variables listed together are iterated in lockstep.
+func (p *parser) parsefor(pos int) {
+	vars := p.forvars(pos)
+	defer func() {
+		for _, lv := range vars {
+			delete(p.values, lv.name)
+		}
+	}()
+	body := *p.r
+	for i := range vars[0].v {
+		*p.r = body
+		for _, lv := range vars {
+			p.values[lv.name] = lv.v[i]
+		}
+		p.parsebody(pos, "for")
+	}
+	if len(vars[0].v) == 0 {
+		p.skipbody(pos, "for")
+		return
+	}
+	p.r.eat("end")
+	p.r.endstatement()
+}
+
+// forvars parses the variables in the header of the for statement at pos.
+func (p *parser) forvars(pos int) []loopvar {
+	defer p.recoverheader(pos, "for")
+	var vars []loopvar
+	for {
+		p.r.skiplinespace()
+		npos := p.r.pos
+		lv := loopvar{name: p.r.name()}
+		if _, ok := p.lookup(lv.name); ok {
+			panic(p.src.errorat(npos, errf("loop variable '%s' already defined", lv.name)))
+		}
+		for _, x := range vars {
+			if x.name == lv.name {
+				panic(p.src.errorat(npos, errf("duplicate loop variable '%s'", lv.name)))
+			}
+		}
+		p.r.skiplinespace()
+		if !p.r.eat("in") {
+			panic("'in' expected after loop variable")
+		}
+		lv.v = p.loopvalues()
+		if len(vars) != 0 && len(lv.v) != len(vars[0].v) {
+			panic(p.src.errorat(npos, errf("loop variable '%s' has %d values, '%s' has %d",
+				lv.name, len(lv.v), vars[0].name, len(vars[0].v))))
+		}
+		vars = append(vars, lv)
+		p.r.skiplinespace()
+		if !p.r.eatch(',') {
+			break
+		}
+	}
+	p.r.endstatement()
+	return vars
+}
+
+// parsebody parses the statements of the body of the for or layer
+// statement kw at pos, and stops before its end.
+func (p *parser) parsebody(pos int, kw string) {
+	nconds := len(p.conds)
+	for {
+		p.r.skipallspace()
+		if p.r.eof() {
+			panic(p.src.errorat(pos, kw+" without end"))
+		}
+		if len(p.conds) == nconds && p.r.at("end") {
+			return
+		}
+		p.statement()
+	}
+}
+
+// loopvalues parses the values of a loop variable. Values are names,
+// or integers given as numbers, constants or computations within
+// parentheses. Ranges of integers are written as 1..4.
+func (p *parser) loopvalues() []interface{} {
+	var v []interface{}
+	for {
+		p.r.skiplinespace()
+		ch := p.r.ch()
+		if isnamestart(ch) {
+			t := *p.r
+			if n := t.name(); !p.isconstant(n) {
+				p.r.name()
+				v = append(v, Ident(n))
+				continue
+			}
+		} else if !isdigit(ch) && ch != '-' && ch != '(' {
+			return v
+		}
+		a := p.loopint()
+		if !p.r.eatch('.') {
+			v = append(v, float64(a))
+			continue
+		}
+		if !p.r.eatch('.') {
+			panic("'..' expected")
+		}
+		b := p.loopint()
+		step := 1
+		if b < a {
+			step = -1
+		}
+		for i := a; i != b+step; i += step {
+			v = append(v, float64(i))
+		}
+	}
+}
+
+// isconstant reports if n is the name of a constant.
+func (p *parser) isconstant(n string) bool {
+	_, ok := p.constant(n)
+	return ok
+}
+
+// loopint parses an integer value of a loop variable.
+func (p *parser) loopint() int {
+	pos := p.r.pos
+	var x float64
+	neg := p.r.eatch('-')
+	if isdigit(p.r.ch()) {
+		// not using valfactor, so that the dots of ranges are left
+		n, _ := p.r.digits()
+		x = float64(n)
+	} else {
+		x = p.valfactor(false)
+	}
+	if neg {
+		x = -x
+	}
+	if x != math.Trunc(x) {
+		panic(p.src.errorat(pos, errf("integer expected, have %g", x)))
+	}
+	return int(x)
+}
+
+// subst parses the $ reference at r within a name or selector. References
+// are either $name, where name is a loop variable or another constant,
+// or a computation such as $(n+10).
+func (p *parser) subst(r *sourcereader) string {
+	saved := p.r
+	p.r = r
+	defer func() {
+		p.r = saved
+	}()
+	pos := r.pos
+	r.eatch('$')
+	var v interface{}
+	if r.ch() == '(' {
+		v = p.valfactor(false)
+	} else {
+		npos := r.pos
+		if !isnamestart(r.ch()) {
+			panic(p.src.errorat(pos, "name or '(' expected after '$'"))
+		}
+		subst := r.subst
+		r.subst = nil
+		n := r.name()
+		r.subst = subst
+		var ok bool
+		if v, ok = p.constant(n); !ok {
+			e := p.src.errorat(npos, errf("unknown value '%s'", n))
+			e.Hint = suggest(n, p.constnames())
+			panic(e)
+		}
+	}
+	switch x := v.(type) {
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case Ident:
+		return string(x)
+	case string:
+		return x
+	}
+	panic(p.src.errorat(pos, errf("%s can't be used in names", describe(v))))
+}
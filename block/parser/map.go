@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mapping is a map statement. It is expanded into links after the parameters
+// of blocks are checked, so that ports listed using '*' are known.
+type mapping struct {
+	src     *source
+	pos     int
+	layer   *layer // layer of the statement, if any
+	sinks   *mapitem
+	sources []*mapitem
+}
+
+// mapitem is a range of ports such as hat1..4, all ports of a block
+// listed using '*', or a single source of a map statement.
+type mapitem struct {
+	named            // block of the ports, sel is unused
+	sels  []string   // ports listed, nil for all of them
+	s     specSource // source other than ports of a block, if set
+}
+
+// parsemap parses a map statement starting at pos. The first item
+// lists inputs, the rest of the items the sources connected to them.
+func (p *parser) parsemap(pos int) {
+	m := &mapping{src: p.src, pos: pos, layer: p.layer}
+	p.r.skiplinespace()
+	m.sinks = p.mapitem(true)
+	for {
+		p.r.skiplinespace()
+		if ch := p.r.ch(); p.r.eof() || ch == '\n' || ch == ';' || ch == '#' {
+			break
+		}
+		m.sources = append(m.sources, p.mapitem(false))
+	}
+	p.r.endstatement()
+	if len(m.sources) == 0 {
+		panic(p.src.errorat(pos, "map needs sources"))
+	}
+	p.maps = append(p.maps, m)
+}
+
+// mapitem parses an item of a map statement.
+func (p *parser) mapitem(sink bool) *mapitem {
+	pos := p.r.pos
+	if ch := p.r.ch(); !sink && !isnamestart(ch) && ch != '$' {
+		return &mapitem{s: p.parsesource()}
+	}
+	it := &mapitem{named: named{p.src, p.scope, p.r.sourceline(), pos, "", ""}}
+	t := *p.r
+	it.name = t.name()
+	if t.eatch('.') && t.eatch('*') {
+		*p.r = t
+		return it
+	}
+	name, sel := p.r.spec()
+	it.name = name
+	if sink && sel == "" {
+		panic(p.src.errorat(pos, errf("map needs ports of '%s'", name)))
+	}
+	if p.r.ch() != '.' {
+		it.sels = []string{sel}
+		return it
+	}
+	p.r.eatch('.')
+	if !p.r.eatch('.') {
+		panic("'..' expected")
+	}
+	i := strings.LastIndexFunc(sel, func(ch rune) bool { return !isdigit(ch) }) + 1
+	if i == len(sel) {
+		panic(p.src.errorat(pos, errf("range needs numbered ports, have '%s'", sel)))
+	}
+	a, _ := strconv.Atoi(sel[i:])
+	b := p.loopint()
+	step := 1
+	if b < a {
+		step = -1
+	}
+	for n := a; n != b+step; n += step {
+		it.sels = append(it.sels, sel[:i]+strconv.Itoa(n))
+	}
+	return it
+}
+
+// links returns the links of m.
+func (m *mapping) links() ([]Link, error) {
+	sels, err := m.sinks.ports(true)
+	if err != nil {
+		return nil, err
+	}
+	var sinks []specSink
+	for _, sel := range sels {
+		n := m.sinks.named
+		n.sel = sel
+		sinks = append(sinks, &namedsink{n})
+	}
+	var sources []specSource
+	for _, it := range m.sources {
+		if it.s != nil {
+			sources = append(sources, it.s)
+			continue
+		}
+		sels, err := it.ports(false)
+		if err != nil {
+			return nil, err
+		}
+		for _, sel := range sels {
+			n := it.named
+			n.sel = sel
+			sources = append(sources, &namedsource{n})
+		}
+	}
+	if len(sinks) != len(sources) {
+		return nil, m.src.errorat(m.pos, errf("map has %d inputs and %d sources", len(sinks), len(sources)))
+	}
+	v := make([]Link, len(sinks))
+	for i := range sinks {
+		v[i] = Link{sinks[i], sources[i], m.src, m.layer}
+	}
+	return v, nil
+}
+
+// ports returns the names of the ports of it. Ports listed
+// using '*' are the inputs of blocks for sinks, or their outputs.
+func (it *mapitem) ports(sink bool) ([]string, error) {
+	if it.sels != nil {
+		return it.sels, nil
+	}
+	var pm portMapper
+	if sink {
+		pm, _ = it.scope.sink(it.name)
+	} else {
+		var p specSource
+		if p, pm = it.scope.source(it.name); p != nil {
+			return nil, it.src.errorat(it.pos, errf("'%s' is a port, '*' needs a block", it.name))
+		}
+	}
+	switch x := pm.(type) {
+	case nil:
+		_, _, err := it.resolve(nil, sink)
+		return nil, err
+	case *instance:
+		if sink {
+			return x.def.inputs, nil
+		}
+		return x.def.outputs, nil
+	case *Blk:
+		if !x.paramok {
+			return nil, errBadName
+		}
+		if sink {
+			return x.inputs().Names(), nil
+		}
+		if ol, ok := x.Type.(OutputLister); ok {
+			return ol.OutputNames(x.param(), x.globals), nil
+		}
+	}
+	return nil, it.src.errorat(it.pos, errf("ports of '%s' can't be listed using '*'", it.name))
+}
@@ -1,156 +1,282 @@
 package parser
 
+import (
+	"strings"
+)
+
 type Param interface {
-	reader(globals NamedParam) ParamReader
+	args() argsource
 }
 
-type PosParam []float64
+// PosParam is a positional argument list. Values are
+// float64, string, Ident or []float64. Values of type int
+// are also accepted for numbers.
+type PosParam []interface{}
+
+func (p PosParam) args() argsource { return &posargs{v: p} }
 
-func (p PosParam) reader(globals NamedParam) ParamReader { return newpospr(p, globals) }
+// NamedParam is a named argument list, with values like those of PosParam.
+type NamedParam map[string]interface{}
 
-type NamedParam map[string]float64
+func (p NamedParam) args() argsource { return &namedargs{m: p, used: make(map[string]bool)} }
 
-func (p NamedParam) reader(globals NamedParam) ParamReader { return newnamedpr(p, globals) }
+// Ident is an identifier used as a value, such as the name of a curve.
+type Ident string
 
+// ParamReader reads arguments of blocks. Arguments missing are taken from
+// the globals of the reader, errors are reported by Err.
 type ParamReader interface {
 	Arg(n string) float64
 	OptArg(n string, def float64) float64
+	StrArg(n string) string
+	OptStrArg(n string, def string) string
+	IdentArg(n string, choices ...string) string
+	OptIdentArg(n string, def string, choices ...string) string
+	ListArg(n string) []float64
+	OptListArg(n string, def []float64) []float64
 	Err() error
 }
 
 func NewParamReader(p Param, globals NamedParam) ParamReader {
+	return newparamreader(p, globals)
+}
+
+func newparamreader(p Param, globals NamedParam) *paramreader {
+	r := &paramreader{globals: globals}
 	if p != nil {
-		return p.reader(globals)
+		r.src = p.args()
+	} else {
+		r.src = emptyargs{}
 	}
-	return &emptypr{globals, nil}
+	return r
 }
 
-type pospr struct {
-	v       []float64
-	globals map[string]float64
+// argsource provides the arguments of a Param.
+type argsource interface {
+	arg(n string) (interface{}, bool)
+	missing(n string) error // error for argument n missing
+	check() error           // error for arguments not used
+}
+
+type paramreader struct {
+	src     argsource
+	globals NamedParam
 
-	idx      int
 	firsterr error
 }
 
-func newpospr(p PosParam, globals NamedParam) ParamReader { return &pospr{v: p, globals: globals} }
+func (r *paramreader) Arg(n string) float64 { return r.number(n, 0, false) }
 
-func (p *pospr) Arg(n string) float64 {
-	if p.idx < len(p.v) {
-		i := p.idx
-		p.idx++
-		return p.v[i]
+func (r *paramreader) OptArg(n string, def float64) float64 { return r.number(n, def, true) }
+
+func (r *paramreader) StrArg(n string) string { return r.str(n, "", false) }
+
+func (r *paramreader) OptStrArg(n string, def string) string { return r.str(n, def, true) }
+
+func (r *paramreader) IdentArg(n string, choices ...string) string {
+	return r.ident(n, "", false, choices)
+}
+
+func (r *paramreader) OptIdentArg(n string, def string, choices ...string) string {
+	return r.ident(n, def, true, choices)
+}
+
+func (r *paramreader) ListArg(n string) []float64 { return r.list(n, nil, false) }
+
+func (r *paramreader) OptListArg(n string, def []float64) []float64 { return r.list(n, def, true) }
+
+func (r *paramreader) Err() error {
+	if r.firsterr != nil {
+		return r.firsterr
 	}
-	if v, ok := p.globals[n]; ok {
-		return v
+	return r.src.check()
+}
+
+// value returns the argument for n. Missing arguments
+// are reported unless opt is true.
+func (r *paramreader) value(n string, opt bool) (interface{}, bool) {
+	if v, ok := r.src.arg(n); ok {
+		return v, true
+	}
+	if v, ok := r.globals[n]; ok {
+		return v, true
 	}
-	if p.firsterr == nil {
-		p.firsterr = errf("argument '%s' missing at position %d missing", n, p.idx)
+	if !opt {
+		r.seterr(r.src.missing(n))
 	}
-	return 0
+	return nil, false
 }
 
-func (p *pospr) OptArg(n string, def float64) float64 {
-	if p.idx < len(p.v) {
-		i := p.idx
-		p.idx++
-		return p.v[i]
+func (r *paramreader) number(n string, def float64, opt bool) float64 {
+	v, ok := r.value(n, opt)
+	if !ok {
+		return def
+	}
+	if x, ok := number(v); ok {
+		return x
 	}
-	if v, ok := p.globals[n]; ok {
-		return v
+	if x, ok := v.(Ident); ok {
+		r.seterr(errf("argument '%s': unknown value '%s'", n, x))
+	} else {
+		r.mismatch(n, "a number", v)
 	}
 	return def
 }
 
-func (p *pospr) Err() error {
-	if p.firsterr != nil {
-		return p.firsterr
+func (r *paramreader) str(n string, def string, opt bool) string {
+	v, ok := r.value(n, opt)
+	if !ok {
+		return def
 	}
-	if p.idx < len(p.v) {
-		return errf("too many arguments (needs at most %d, have %d)", p.idx, len(p.v))
+	switch x := v.(type) {
+	case string:
+		return x
+	case Ident:
+		return string(x)
 	}
-	return nil
+	r.mismatch(n, "a string", v)
+	return def
 }
 
-type namedpr struct {
-	m       map[string]float64
-	globals map[string]float64
+func (r *paramreader) ident(n string, def string, opt bool, choices []string) string {
+	v, ok := r.value(n, opt)
+	if !ok {
+		return def
+	}
+	x, ok := v.(Ident)
+	if !ok {
+		r.mismatch(n, "an identifier", v)
+		return def
+	}
+	if len(choices) != 0 && !has(choices, string(x)) {
+		r.seterr(errf("argument '%s': '%s' is not one of %s", n, x, strings.Join(choices, ", ")))
+		return def
+	}
+	return string(x)
+}
 
-	used     map[string]bool
-	firsterr error
+func (r *paramreader) list(n string, def []float64, opt bool) []float64 {
+	v, ok := r.value(n, opt)
+	if !ok {
+		return def
+	}
+	if x, ok := v.([]float64); ok {
+		return x
+	}
+	if x, ok := number(v); ok {
+		return []float64{x}
+	}
+	r.mismatch(n, "a list of numbers", v)
+	return def
 }
 
-func newnamedpr(p, globals NamedParam) ParamReader {
-	return &namedpr{m: p, globals: globals, used: make(map[string]bool)}
+func (r *paramreader) mismatch(n, want string, v interface{}) {
+	r.seterr(errf("argument '%s' must be %s, have %s", n, want, describe(v)))
 }
 
-func (p *namedpr) Arg(n string) float64 {
-	v, ok := p.val(n, 0)
-	if !ok && p.firsterr == nil {
-		p.firsterr = errf("argument '%s' missing", n)
+func (r *paramreader) seterr(err error) {
+	if r.firsterr == nil {
+		r.firsterr = err
 	}
-	return v
 }
 
-func (p *namedpr) OptArg(n string, def float64) float64 {
-	v, _ := p.val(n, def)
-	return v
+// number returns the numeric value of v.
+func number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case int:
+		return float64(x), true
+	}
+	return 0, false
 }
 
-func (p *namedpr) val(n string, def float64) (v float64, ok bool) {
-	if v, ok = p.m[n]; ok {
-		p.used[n] = true
-		return
-	}
-	if v, ok = p.globals[n]; ok {
-		return
+// describe returns the kind of the value v for error messages.
+func describe(v interface{}) string {
+	switch x := v.(type) {
+	case float64, int:
+		return "number"
+	case string:
+		return "string"
+	case Ident:
+		return "identifier '" + string(x) + "'"
+	case []float64:
+		return "list"
 	}
-	return def, false
+	return "invalid value"
 }
 
-func (p *namedpr) Err() error {
-	if p.firsterr != nil {
-		return p.firsterr
+// truth reports if v is nonzero or not empty.
+func truth(v interface{}) bool {
+	if x, ok := number(v); ok {
+		return x != 0
 	}
-	if len(p.m) != len(p.used) {
-		for n := range p.m {
-			if !p.used[n] {
-				return errf("named parameter '%s' unknown", n)
-			}
-		}
+	switch x := v.(type) {
+	case string:
+		return x != ""
+	case Ident:
+		return x != ""
+	case []float64:
+		return len(x) != 0
 	}
-	return nil
+	return false
 }
 
-type emptypr struct {
-	globals map[string]float64
-
-	firsterr error
+type posargs struct {
+	v   PosParam
+	idx int
 }
 
-func (p *emptypr) Arg(n string) float64 {
-	v, ok := p.val(n, 0)
-	if !ok && p.firsterr == nil {
-		p.firsterr = errf("argument '%s' missing", n)
+func (p *posargs) arg(n string) (interface{}, bool) {
+	if p.idx < len(p.v) {
+		i := p.idx
+		p.idx++
+		return p.v[i], true
 	}
-	return v
+	return nil, false
 }
 
-func (p *emptypr) OptArg(n string, def float64) float64 {
-	v, _ := p.val(n, def)
-	return v
+func (p *posargs) missing(n string) error {
+	return errf("argument '%s' missing at position %d", n, p.idx)
 }
 
-func (p *emptypr) Err() error {
-	if p.firsterr != nil {
-		return p.firsterr
+func (p *posargs) check() error {
+	if p.idx < len(p.v) {
+		return errf("too many arguments (needs at most %d, have %d)", p.idx, len(p.v))
 	}
 	return nil
 }
 
-func (p *emptypr) val(n string, def float64) (v float64, ok bool) {
-	if v, ok = p.globals[n]; ok {
-		return
+type namedargs struct {
+	m    NamedParam
+	used map[string]bool
+}
+
+func (p *namedargs) arg(n string) (interface{}, bool) {
+	v, ok := p.m[n]
+	if ok {
+		p.used[n] = true
+	}
+	return v, ok
+}
+
+func (p *namedargs) missing(n string) error {
+	return errf("argument '%s' missing", n)
+}
+
+func (p *namedargs) check() error {
+	if len(p.m) != len(p.used) {
+		for n := range p.m {
+			if !p.used[n] {
+				return errf("named parameter '%s' unknown", n)
+			}
+		}
 	}
-	return def, false
+	return nil
 }
+
+type emptyargs struct{}
+
+func (emptyargs) arg(n string) (interface{}, bool) { return nil, false }
+func (emptyargs) missing(n string) error           { return errf("argument '%s' missing", n) }
+func (emptyargs) check() error                     { return nil }
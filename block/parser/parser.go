@@ -2,19 +2,38 @@ package parser
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 )
 
 /*
 stmt :=
+	'include' '"' path '"'
+	'if' ['not'] name
+	'else'
+	'end'
+	'def' name '(' [names] [':' defparam*] ')' ['->' '(' names ')']
+	'out' name blockspec
 	'block' name blockspec
 	'port' name block ['.' spec]
 	'conn' portspec portspec
 	'set' namedarglist
+	'const' name '=' (valexpr | string | list)
 arglist := posarglist | namedarglist
 posarglist :=
 	value [' ' value]*
 value :=
-	digit* [
+	number
+	name
+	'-' value
+	'(' valexpr ')'
+	value ('+' | '-' | '*' | '/' | '%') value
+	'"' string '"'
+	'{' value* '}'
+valexpr :=
+	value, with spaces allowed between operators
+defparam :=
+	name ['=' value]
 namedarglist :=
 	name '=' value [' ' value]*
 portspecs := portspec [' ' portspec]*
@@ -25,7 +44,14 @@ blockspec :=
 	plugvalue
 	portspec
 	newblockspec
+	'(' expr ')'
 	{ newblockspec [newblockspec]* }
+expr :=
+	unary [binop unary]*
+unary :=
+	['!' | '-'] blockspec
+binop :=
+	'||' | '&&' | '==' | '!=' | '<' | '>' | '<=' | '>=' | '+' | '-' | '*' | '/' | '%'
 newblockspec :=
 	'[' blocktype [portspecs] [':' arglist] ']'
 	'$' '[' blocktype [':' arglist] ']'
@@ -39,7 +65,8 @@ plugvalue :=
 
 type parser struct {
 	*context
-	r *sourcereader
+	r    *sourcereader
+	errs ErrorList
 }
 
 // copy of values in block
@@ -65,62 +92,266 @@ func newparser(t TypeMap) *parser {
 	return &parser{context: newcontext(t)}
 }
 
-func (p *parser) parse(src []byte) (err error) {
-	p.r = &sourcereader{src: src}
+// parse parses src. Parsing continues after errors with the
+// next statement, so that all problems can be reported at once.
+func (p *parser) parse(src []byte) error {
+	if p.src == nil {
+		p.src = &source{src: src}
+	}
+	p.r = &sourcereader{src: src, subst: p.subst}
+	for {
+		p.r.skipallspace()
+		if p.r.eof() {
+			break
+		}
+		p.statement()
+	}
+	p.checkconds(0)
+	if len(p.errs) != 0 {
+		return p.errs
+	}
+	return nil
+}
+
+// statement parses a single statement. Upon error it skips to the next
+// statement, and blocks or ports the statement meant to define are
+// marked bad to avoid further errors referring to them.
+func (p *parser) statement() {
+	start, name := p.r.pos, ""
 	defer func() {
 		if r := recover(); r != nil {
-			err = p.r.formaterror(r)
+			if e, ok := r.(*Error); ok {
+				p.errs = append(p.errs, e)
+			} else {
+				p.errs = append(p.errs, p.src.errorat(p.r.pos, r))
+			}
+			if name != "" && !p.defined(name) {
+				p.badNames[name] = true
+			}
+			p.r.resync(start)
 		}
 	}()
-	p.parseimpl()
-	return
+	switch {
+	case p.r.eatch('#'):
+		p.r.skipline()
+	case p.r.eat("include"):
+		p.r.skiplinespace()
+		pos := p.r.pos
+		fn := p.r.str()
+		p.r.endstatement()
+		p.include(pos, fn)
+	case p.r.eat("set"):
+		p.r.skiplinespace()
+		m, ok := p.parseparam().(NamedParam)
+		if !ok {
+			panic("'set' needs named parameters")
+		}
+		for n, v := range m {
+			p.sets[n] = true
+			if _, ok := p.defines[n]; !ok {
+				p.config[n] = v
+			}
+		}
+		p.r.endstatement()
+	case p.r.eat("const"):
+		p.r.skiplinespace()
+		pos := p.r.pos
+		n := p.r.name()
+		if _, ok := p.values[n]; ok {
+			panic(p.src.errorat(pos, errf("duplicate const '%s'", n)))
+		}
+		p.r.skiplinespace()
+		if !p.r.eatch('=') {
+			panic("'=' expected after const name")
+		}
+		p.values[n] = p.constvalue()
+		p.r.endstatement()
+	case p.r.eat("if"):
+		c := &cond{src: p.src, scope: p.scope, pos: start}
+		p.conds = append(p.conds, c)
+		p.r.skiplinespace()
+		neg := p.r.eat("not")
+		x, _ := p.constant(p.r.name())
+		v := truth(x)
+		p.r.endstatement()
+		if v == neg {
+			p.skipsection(c)
+		}
+	case p.r.eat("else"):
+		c := p.topcond()
+		if c.haselse {
+			panic("duplicate else")
+		}
+		c.haselse = true
+		p.r.endstatement()
+		p.skipsection(c)
+	case p.r.eat("end"):
+		p.topcond()
+		p.conds = p.conds[:len(p.conds)-1]
+		p.r.endstatement()
+	case p.r.eat("def"):
+		p.parsedef(start)
+	case p.r.eat("for"):
+		p.parsefor(start)
+	case p.r.eat("in"):
+		if p.inst == nil || !p.inst.def.group {
+			panic("'in' used outside group")
+		}
+		p.declare(false)
+	case p.r.eat("out"):
+		if p.inst != nil && p.inst.def.group {
+			p.declare(true)
+			break
+		}
+		if p.inst == nil {
+			panic("'out' used outside def")
+		}
+		p.r.skiplinespace()
+		pos := p.r.pos
+		n := p.r.name()
+		d := p.inst.def
+		if !has(d.outputs, n) {
+			e := p.src.errorat(pos, errf("def '%s' has no %s", d.name, nice(outport, n)))
+			e.Hint = suggest(n, d.outputs)
+			panic(e)
+		}
+		if _, ok := p.inst.outputs[n]; ok {
+			panic(p.src.errorat(pos, errf("duplicate %s", nice(outport, n))))
+		}
+		p.inst.outputs[n] = p.parsesource()
+		p.r.endstatement()
+	case p.r.eat("port"):
+		name = p.r.name()
+		p.r.skiplinespace()
+		pos := p.r.pos
+		blk, spec := p.r.spec()
+		s := p.nsource(pos, blk, spec)
+		p.portNames[name] = s
+		p.aliases = append(p.aliases, alias{name, s})
+		p.r.endstatement()
+	case p.r.eat("block"):
+		name = p.r.name()
+		p.topblockspec(name)
+		p.r.endstatement()
+	case p.r.eat("conn"):
+		pos := p.r.pos
+		name, spec := p.r.spec()
+		k := p.nsink(pos, name, spec)
+		p.vlink = append(p.vlink, Link{k, p.parsesource(), p.src, p.layer})
+		p.r.endstatement()
+	case p.r.eat("map"):
+		p.parsemap(start)
+	case p.r.eat("layer"):
+		p.parselayer(start)
+	default:
+		panic("unexpected")
+	}
+}
+
+// include parses the file fn. Relative paths are relative to the
+// directory of the file being parsed. The position of the file
+// name is pos.
+func (p *parser) include(pos int, fn string) {
+	if !filepath.IsAbs(fn) && p.src.name != "" {
+		fn = filepath.Join(filepath.Dir(p.src.name), fn)
+	}
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		panic(p.src.errorat(pos, err))
+	}
+	for s := p.src; s != nil; s = s.parent {
+		if s.abs == abs {
+			panic(p.src.errorat(pos, errf("include cycle: '%s' includes itself", fn)))
+		}
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		panic(p.src.errorat(pos, err))
+	}
+	p.files = append(p.files, fn)
+
+	r, src := p.r, p.src
+	defer func() {
+		p.r, p.src = r, src
+	}()
+	p.src = &source{name: fn, src: data, abs: abs, parent: src}
+	p.r = &sourcereader{src: data, subst: p.subst}
+	nconds := len(p.conds)
+	for {
+		p.r.skipallspace()
+		if p.r.eof() {
+			break
+		}
+		p.statement()
+	}
+	p.checkconds(nconds)
 }
 
-func (p *parser) parseimpl() {
+// topcond returns the innermost if statement open in the current source.
+func (p *parser) topcond() *cond {
+	if len(p.conds) == 0 {
+		panic("no if statement open")
+	}
+	if c := p.conds[len(p.conds)-1]; c.src != p.src || c.scope != p.scope {
+		panic("no if statement open")
+	}
+	return p.conds[len(p.conds)-1]
+}
+
+// skipsection skips statements in the section of c being parsed.
+// Skipping stops before the end of c, or after its else
+// if the if section of c is skipped.
+func (p *parser) skipsection(c *cond) {
+	depth := 0
 	for !p.r.eof() {
 		p.r.skipallspace()
 		switch {
-		case p.r.eatch('#'):
-			p.r.skipline()
-		case p.r.eat("set"):
-			p.r.skiplinespace()
-			m, ok := p.parseparam().(NamedParam)
-			if !ok {
-				panic("'set' needs named parameters")
+		case p.r.at("if"), p.r.at("def"), p.r.at("for"), p.r.at("layer"):
+			depth++
+		case p.r.at("end"):
+			if depth == 0 {
+				return
 			}
-			for n, v := range m {
-				p.config[n] = v
+			depth--
+		case p.r.at("else"):
+			if depth == 0 {
+				if c.haselse {
+					panic("duplicate else")
+				}
+				c.haselse = true
+				p.r.eat("else")
+				p.r.endstatement()
+				return
 			}
-			p.r.endstatement()
-		case p.r.eat("port"):
-			name := p.r.name()
-			p.r.skiplinespace()
-			blk, spec := p.r.spec()
-			p.portNames[name] = nsource(p.r.sourceline(), blk, spec)
-		case p.r.eat("block"):
-			name := p.r.name()
-			p.topblockspec(name)
-			p.r.endstatement()
-		case p.r.eat("conn"):
-			name, spec := p.r.spec()
-			lineno := p.r.sourceline()
-			p.vlink = append(p.vlink, Link{nsink(lineno, name, spec), p.parsesource()})
-			p.r.endstatement()
-		default:
-			panic("unexpected")
 		}
+		p.r.skipline()
 	}
 }
 
-func (p *parser) topblockspec(name string) {
+// checkconds reports if statements left open in the current source.
+func (p *parser) checkconds(n int) {
+	for len(p.conds) > n {
+		c := p.conds[len(p.conds)-1]
+		p.errs = append(p.errs, c.src.errorat(c.pos, "if without end"))
+		p.conds = p.conds[:len(p.conds)-1]
+	}
+}
+
+// defined reports if name is defined as a block or port.
+func (p *parser) defined(name string) bool {
 	if _, ok := p.portNames[name]; ok {
-		panic("duplicate name")
+		return true
 	}
 	if _, ok := p.sinkNames[name]; ok {
-		panic("duplicate name")
+		return true
 	}
-	if _, ok := p.sourceNames[name]; ok {
-		panic("duplicate name")
+	_, ok := p.sourceNames[name]
+	return ok
+}
+
+func (p *parser) topblockspec(name string) {
+	if p.defined(name) {
+		panic(errf("duplicate name '%s'", name))
 	}
 	p.r.skiplinespace()
 	switch p.r.ch() {
@@ -136,32 +367,63 @@ func (p *parser) topblockspec(name string) {
 
 func (p *parser) parsesource() (input specSource) {
 	p.r.skiplinespace()
+	defer func(pos int) {
+		if input != nil {
+			p.srcpos[input] = pos
+		}
+	}(p.r.pos)
 	switch {
 	case p.r.ch() == '[':
-		lno := p.r.sourceline()
-		blk := p.newstandaloneblk("", inpdef_required)
-		blk.oc = &outputconstraint{"block used as input source must have unnamed output", []string{""}}
-		input = &concreteblksource{lno, blk, ""}
+		lno, pos := p.r.sourceline(), p.r.pos
+		pm := p.newstandaloneblk("", inpdef_required)
+		sel, spos := "", pos
+		if p.r.eatch('.') {
+			spos = p.r.pos
+			sel = p.r.selector()
+		}
+		switch x := pm.(type) {
+		case *Blk:
+			if sel == "" {
+				x.oc = &outputconstraint{"block used as input source must have " + nice(outport, sel), []string{sel}}
+				input = &concreteblksource{lno, x, sel}
+			} else {
+				// missing outputs are reported where sel is given
+				input = &selsource{concreteblksource{lno, x, sel}, p.src, spos}
+			}
+		case *instance:
+			input = &instoutput{x, sel, p.src, spos}
+		}
+	case p.r.ch() == '(':
+		input = p.expr()
 	case isnumstart(p.r.ch()):
 		n := p.r.number()
 		input = &valueport{p.r.sourceline(), constport{n}}
 	default:
+		pos := p.r.pos
 		n, s := p.r.spec()
-		input = nsource(p.r.sourceline(), n, s)
+		input = p.nsource(pos, n, s)
 	}
 	return
 }
 
 func (p *parser) parseblock(name string) {
-	blk := p.newstandaloneblk(name, inpdef_allowed)
-	p.sinkNames[name] = blk
-	p.sourceNames[name] = blk
+	pm := p.newstandaloneblk(name, inpdef_allowed)
+	p.sinkNames[name] = pm
+	p.sourceNames[name] = pm
 }
 
 func (p *parser) parsegroup(name string) {
+	pos := p.r.pos
 	if !p.r.eatch('{') {
 		panic("invalid group block spec")
 	}
+	p.r.skipallspace()
+	if p.r.at("in") || p.r.at("out") {
+		inst := p.parsesubgraph(name, pos)
+		p.sinkNames[name] = inst
+		p.sourceNames[name] = inst
+		return
+	}
 	var names []string
 	for {
 		p.r.skipallspace()
@@ -184,18 +446,20 @@ func (p *parser) parsegroup(name string) {
 		dollar := p.r.eatch('$')
 		lno := p.r.sourceline()
 		var cur portMapper
+		f, _, _ := p.parsefactory(inpdef_prohibited)
+		if f.def != nil {
+			panic(errf("def '%s' can't be used in groups", f.tname))
+		}
 		if dollar {
-			f, _ := p.parsefactory(inpdef_prohibited)
 			m := make(map[string]*Blk)
 			for _, sel := range names {
-				blk := p.newblk(lno, fmt.Sprintf("%s#%d.%s", name, idx, sel), f.typ, f.param)
+				blk := p.newblk(lno, fmt.Sprintf("%s#%d.%s", name, idx, sel), f.tname, f.typ, f.param)
 				blk.oc = &outputconstraint{fmt.Sprintf("group '%s' $element '%s' needs unnamed output", name, f.typ), []string{""}}
 				m[sel] = blk
 			}
 			cur = &dollarPortMapper{p.r.sourceline(), m}
 		} else {
-			f, _ := p.parsefactory(inpdef_prohibited)
-			blk := p.newblk(lno, fmt.Sprintf("%s#%d", name, idx), f.typ, f.param)
+			blk := p.newblk(lno, fmt.Sprintf("%s#%d", name, idx), f.tname, f.typ, f.param)
 			blk.oc = &outputconstraint{fmt.Sprintf("group '%s' element '%s' needs names: %v", name, f.typ, names), names}
 			cur = blk
 		}
@@ -211,7 +475,7 @@ func (p *parser) parsegroup(name string) {
 				if err != nil {
 					panic(err) // impossible
 				}
-				p.vlink = append(p.vlink, Link{&concreteblksink{lno, kblk, ksel}, &concreteblksource{lno, eblk, esel}})
+				p.link(&concreteblksink{lno, kblk, ksel}, &concreteblksource{lno, eblk, esel})
 			}
 		}
 		last = cur
@@ -224,17 +488,38 @@ func (p *parser) parsegroup(name string) {
 	p.sourceNames[name] = last
 }
 
-func (p *parser) parsefactory(inpdisp int) (f *factory, inputs []specSource) {
+// namedinput is an input given by name within brackets, as in [toggle set=btn].
+type namedinput struct {
+	pos  int
+	name string
+	s    specSource
+}
+
+// parsefactory parses a block within brackets. Inputs may be listed in order
+// before its parameters, followed by inputs given by name.
+func (p *parser) parsefactory(inpdisp int) (f *factory, inputs []specSource, named []namedinput) {
 	p.r.skiplinespace()
 	if !p.r.eatch('[') {
 		panic("invalid factory block spec")
 	}
 	f = new(factory)
+	pos := p.r.pos
 	f.tname = p.r.name()
 	var err error
-	f.typ, err = p.GetType(f.tname)
+	if f.def = p.defs[f.tname]; f.def == nil {
+		f.typ, err = p.GetType(f.tname)
+	}
 	if err != nil {
-		panic(err)
+		e := p.src.errorat(pos, err)
+		var names []string
+		if tl, ok := p.TypeMap.(TypeLister); ok {
+			names = tl.TypeNames()
+		}
+		for n := range p.defs {
+			names = append(names, n)
+		}
+		e.Hint = suggest(f.tname, names)
+		panic(e)
 	}
 
 	for {
@@ -255,22 +540,51 @@ func (p *parser) parsefactory(inpdisp int) (f *factory, inputs []specSource) {
 		if inpdisp == inpdef_prohibited {
 			panic(errf("input declaration for '%s' not allowed", f.tname))
 		}
-		inputs = append(inputs, p.parsesource())
+		if p.atnamedparam() {
+			named = append(named, p.namedinput(f, inputs, named))
+		} else if len(named) != 0 {
+			panic("inputs given by name must follow those listed in order")
+		} else {
+			inputs = append(inputs, p.parsesource())
+		}
 	}
 
-	if ng, na := len(inputs), len(f.typ.Input().Names()); ng > na {
+	if ng, na := len(inputs), len(f.inputs()); ng > na {
 		panic(errf("type '%s' was given %d inputs, but has only %d", f.tname, ng, na))
 	}
 	return
 }
 
+// namedinput parses an input of the block of f given by name. Inputs
+// and named are those given already.
+func (p *parser) namedinput(f *factory, inputs []specSource, named []namedinput) namedinput {
+	pos := p.r.pos
+	n := p.r.name()
+	p.r.eatch('=')
+	names := f.inputs()
+	i := indexof(names, n)
+	if i == -1 {
+		e := p.src.errorat(pos, errf("type '%s' has no %s", f.tname, nice(inport, n)))
+		e.Hint = suggest(n, names)
+		panic(e)
+	}
+	dup := i < len(inputs)
+	for _, x := range named {
+		dup = dup || x.name == n
+	}
+	if dup {
+		panic(p.src.errorat(pos, errf("%s given twice", nice(inport, n))))
+	}
+	return namedinput{pos, n, p.parsesource()}
+}
+
 func (p *parser) parseparam() Param {
 	p.r.skiplinespace()
-	if isdigit(p.r.ch()) || p.r.ch() == '-' {
+	if !p.atnamedparam() {
 		var param PosParam
 		for {
-			param = append(param, p.r.number())
-			if !isdigit(p.r.ch()) {
+			param = append(param, p.value())
+			if !isvaluestart(p.r.ch()) {
 				break
 			}
 		}
@@ -282,7 +596,7 @@ func (p *parser) parseparam() Param {
 			if !p.r.eatch('=') {
 				panic("'=' expected after name")
 			}
-			param[name] = p.r.number()
+			param[name] = p.value()
 			p.r.skiplinespace()
 			if !isnamestart(p.r.ch()) {
 				break
@@ -293,29 +607,64 @@ func (p *parser) parseparam() Param {
 	return nil // not reached
 }
 
-func (p *parser) newstandaloneblk(name string, inpdisp int) *Blk {
-	lno := p.r.sourceline()
-	f, inputs := p.parsefactory(inpdisp)
+// atnamedparam reports if a named parameter is next in the source.
+func (p *parser) atnamedparam() bool {
+	t := *p.r
+	if !isnamestart(t.ch()) {
+		return false
+	}
+	t.name()
+	return t.eatch('=')
+}
+
+// newstandaloneblk parses a block, and returns either
+// a *Blk or an *instance for defs.
+func (p *parser) newstandaloneblk(name string, inpdisp int) portMapper {
+	lno, pos := p.r.sourceline(), p.r.pos
+	f, inputs, named := p.parsefactory(inpdisp)
 	if name == "" {
 		name = fmt.Sprintf("«%s:%d»", f.tname, lno)
 	}
-	blk := p.newblk(lno, name, f.typ, f.param)
+	if f.def != nil {
+		inst := p.expand(f.def, name, f.param, pos)
+		for i, n := range f.def.inputs {
+			if i < len(inputs) {
+				inst.bind(n, inputs[i])
+			}
+		}
+		for _, x := range named {
+			inst.bind(x.name, x.s)
+		}
+		return inst
+	}
+	blk := p.newblk(lno, name, f.tname, f.typ, f.param)
 	if len(inputs) != 0 {
-		for i, n := range f.typ.Input().Names() {
+		for i, n := range f.typ.Input(nil, nil).Names() {
 			if i < len(inputs) {
-				p.vlink = append(p.vlink, Link{&concreteblksink{lno, blk, n}, inputs[i]})
+				p.link(&concreteblksink{lno, blk, n}, inputs[i])
 			}
 		}
 	}
+	for _, x := range named {
+		p.link(&concreteblksink{lno, blk, x.name}, x.s)
+	}
 	return blk
 }
 
-func (p *parser) newblk(lno int, name string, typ Type, param Param) *Blk {
-	blk := &Blk{Name: name, Type: typ, Param: param}
-	if p.blklno == nil {
-		p.blklno = make(map[*Blk]int)
-	}
-	p.blklno[blk] = lno
+func (p *parser) link(k specSink, s specSource) {
+	p.vlink = append(p.vlink, Link{k, s, p.src, nil})
+}
+
+func (p *parser) nsink(pos int, name, sel string) *namedsink {
+	return &namedsink{named{p.src, p.scope, p.r.sourceline(), pos, name, sel}}
+}
+
+func (p *parser) nsource(pos int, name, sel string) *namedsource {
+	return &namedsource{named{p.src, p.scope, p.r.sourceline(), pos, name, sel}}
+}
+
+func (p *parser) newblk(lno int, name, tname string, typ Type, param Param) *Blk {
+	blk := &Blk{Name: p.prefix + name, File: p.src.name, Line: lno, TypeName: tname, Type: typ, Param: param, src: p.src}
 	p.vblk = append(p.vblk, blk)
 	return blk
 }
@@ -2,6 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	gosort "sort"
+	"strings"
 	"testing"
 )
 
@@ -155,6 +161,50 @@ func TestParser(t *testing.T) {
 	//t.Logf("%#v", p)
 }
 
+var errsrc = `
+block input [gamepad: 0]
+block a [deadzon: 0.1]
+conn a input.lx
+block b [toggle inptu.buttona]
+conn b.x 1 )
+block c [deadzone input.lx]
+block d [not input.lx]
+block e [deadzone input.buttona: 0.1]
+`
+
+func TestErrors(t *testing.T) {
+	_, err := read("test.cfg", []byte(errsrc), newtestnamespace(), nil)
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("want ErrorList, got %v", err)
+	}
+	want := []Error{
+		{Line: 3, Col: 10, Hint: "deadzone"},
+		{Line: 5, Col: 17, Hint: "input"},
+		{Line: 6, Col: 6},
+		{Line: 6, Col: 12},
+		{Line: 7},
+		{Line: 8, Col: 14},
+		{Line: 9, Col: 19},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("want %d errors, got %d:\n%v", len(want), len(errs), err)
+	}
+	for i, w := range want {
+		e, ok := errs[i].(*Error)
+		if !ok {
+			t.Errorf("error %d is %T", i, errs[i])
+			continue
+		}
+		if e.File != "test.cfg" || e.Line != w.Line || e.Col != w.Col || e.Hint != w.Hint || e.Text == "" {
+			t.Errorf("error %d is %#v, want line %d col %d hint '%s'", i, e, w.Line, w.Col, w.Hint)
+		}
+	}
+	if e := errs[len(errs)-1].(*Error); e.Msg != "can't connect bool to unnamed input of block 'e' needing axis" {
+		t.Errorf("want type mismatch using port type names, got %v", e)
+	}
+}
+
 type testnamespace struct {
 	m map[string]Type
 }
@@ -166,6 +216,14 @@ func (m *testnamespace) GetType(n string) (Type, error) {
 	return nil, fmt.Errorf("unknown type '%s'", n)
 }
 
+func (m *testnamespace) TypeNames() []string {
+	var v []string
+	for n := range m.m {
+		v = append(v, n)
+	}
+	return v
+}
+
 func (m *testnamespace) add(k Type, names ...string) {
 	if m.m == nil {
 		m.m = make(map[string]Type)
@@ -186,8 +244,11 @@ func newtestnamespace() *testnamespace {
 
 	m.add(kind(si("1"), si("2"), so("")),
 		"add", "sub", "mul", "div", "mod", "pow", "min", "max", "absmin", "absmax")
-	m.add(kind(si("1"), si("2"), bo("")), "eq", "ne", "lt", "gt", "le", "ge")
-	m.add(kind(bi(""), bo(""), bo("1"), bo("2")).arg("NumTaps", "TapDelay", "KeepPushed"), "multibutton")
+	m.add(kind(ai("1"), ai("2"), bo("")), "eq", "ne")
+	m.add(kind(si("1"), si("2"), bo("")), "lt", "gt", "le", "ge")
+	m.add(kind(bi(""), bo("")).arg("NumTaps", "TapDelay", "KeepPushed").numbered("NumTaps", 16), "multibutton")
+	m.add(kind(bi(""), bo("")).delay(), "delay")
+	m.add(kind(si(""), so("")).delay(), "sdelay")
 
 	m.add(kind(si(""), so("")).arg("Value"), "offset")
 	m.add(kind(si(""), so("")).arg("Threshold"), "deadzone")
@@ -196,7 +257,7 @@ func newtestnamespace() *testnamespace {
 	m.add(kind(si(""), so("")).arg("Value"), "truncate")
 	m.add(kind(si(""), so("")).arg("Value"), "dampen")
 	m.add(kind(si(""), so("")).arg("Time"), "smooth")
-	m.add(kind(si(""), so("")).arg("Speed").optarg("Rebound", "QuickCenter"), "incremental")
+	m.add(kind(si(""), so("")).arg("Speed").optarg("Rebound", "QuickCenter").state(), "incremental")
 
 	m.add(kind(si("x"), si("y"), so("x"), so("y")), "stick")
 	m.add(kind(si("x"), si("y"), so("x"), so("y")).arg("Factor"), "circlesquare")
@@ -237,6 +298,10 @@ type testblkkind struct {
 	onames   PortMap
 	optinput bool
 	args     []karg
+	nout     string // parameter with the number of numbered outputs
+	maxout   int
+	delayed  bool
+	stateful bool
 }
 
 func kind(vio ...testio) *testblkkind {
@@ -251,12 +316,58 @@ func kind(vio ...testio) *testblkkind {
 	return t
 }
 
-func (k *testblkkind) Input() PortMap         { return k.inames }
-func (k *testblkkind) Output(PortMap) PortMap { return k.onames }
-func (k *testblkkind) MustHaveInput() bool    { return !k.optinput }
+func (k *testblkkind) Input(Param, NamedParam) PortMap { return k.inames }
+func (k *testblkkind) MustHaveInput() bool             { return !k.optinput }
+
+func (k *testblkkind) Output(p Param, c NamedParam, im PortMap) (PortMap, error) {
+	if k.nout == "" {
+		return k.onames, nil
+	}
+	n := k.maxout
+	if p != nil {
+		n = int(NewParamReader(p, c).OptArg(k.nout, float64(n)))
+	}
+	om := append(PortMap(nil), k.onames...)
+	for i := 1; i <= n; i++ {
+		om = append(om, Port{fmt.Sprint(i), Bool})
+	}
+	return om, nil
+}
+
+// numbered adds bool outputs numbered from 1 to the value of parameter n.
+// Output reports max of them for unknown parameters.
+func (k *testblkkind) numbered(n string, max int) *testblkkind {
+	nk := new(testblkkind)
+	*nk = *k
+	nk.nout, nk.maxout = n, max
+	return nk
+}
+
+func (k *testblkkind) OutputNames(p Param, c NamedParam) []string {
+	om, _ := k.Output(p, c, nil)
+	return om.Names()
+}
+
+func (k *testblkkind) Delayed() bool { return k.delayed }
+
+func (k *testblkkind) delay() *testblkkind {
+	nk := new(testblkkind)
+	*nk = *k
+	nk.delayed = true
+	return nk
+}
+
+func (k *testblkkind) Stateful() bool { return k.stateful }
+
+func (k *testblkkind) state() *testblkkind {
+	nk := new(testblkkind)
+	*nk = *k
+	nk.stateful = true
+	return nk
+}
 
 func (k *testblkkind) Param(p Param, c NamedParam) error {
-	pr := p.Reader(c)
+	pr := NewParamReader(p, c)
 	for _, a := range k.args {
 		if a.opt {
 			pr.OptArg(a.name, 0)
@@ -267,6 +378,14 @@ func (k *testblkkind) Param(p Param, c NamedParam) error {
 	return pr.Err()
 }
 
+func (k *testblkkind) ParamNames() []string {
+	var v []string
+	for _, a := range k.args {
+		v = append(v, a.name)
+	}
+	return v
+}
+
 func (k *testblkkind) inopt() *testblkkind {
 	nk := new(testblkkind)
 	*nk = *k
@@ -297,15 +416,15 @@ type ifblkkind struct {
 	testblkkind
 }
 
-func (k *ifblkkind) Output(im PortMap) PortMap {
+func (k *ifblkkind) Output(p Param, c NamedParam, im PortMap) (PortMap, error) {
 	if im == nil {
-		im = k.Input()
+		im = k.Input(p, c)
 	}
 	th, el := im.Port("then"), im.Port("else")
 	if th == el {
-		return PortMap{Port{"", th}}
+		return PortMap{Port{"", th}}, nil
 	}
-	return PortMap{Port{"", Invalid}}
+	return PortMap{Port{"", Invalid}}, nil
 }
 
 type testsig struct {
@@ -324,3 +443,1009 @@ func ai(name string) testio { return testio{name, true, Any} }
 func bi(name string) testio { return testio{name, true, Bool} }
 func si(name string) testio { return testio{name, true, Scalar} }
 func hi(name string) testio { return testio{name, true, Hat} }
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "joyster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main.cfg": `
+block input [gamepad: 0]
+include "sub/shift.cfg"
+block p0 [not shift]
+`,
+		"sub/shift.cfg": `
+include "../common.cfg"
+port shift input.lbumper
+`,
+		"common.cfg": `
+block rolltoyaw [toggle input.lthumb]
+`,
+		"cycle.cfg": `
+include "sub/cycle.cfg"
+`,
+		"sub/cycle.cfg": `
+block fight [toggle inptu.back]
+include "../cycle.cfg"
+`,
+	}
+	for fn, src := range files {
+		fn = filepath.Join(dir, filepath.FromSlash(fn))
+		os.MkdirAll(filepath.Dir(fn), 0777)
+		if err := ioutil.WriteFile(fn, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := LoadProfile(filepath.Join(dir, "main.cfg"), newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Files) != 2 || len(p.Blocks) != 3 {
+		t.Errorf("want 2 files and 3 blocks, got %q and %d blocks", p.Files, len(p.Blocks))
+	}
+
+	_, err = LoadProfile(filepath.Join(dir, "cycle.cfg"), newtestnamespace(), nil)
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("want 2 errors, got %v", err)
+	}
+	sub := filepath.Join(dir, "sub", "cycle.cfg")
+	for i, lno := range []int{2, 3} {
+		if e, ok := errs[i].(*Error); !ok || e.File != sub || e.Line != lno {
+			t.Errorf("error %d is %v, want %s:%d", i, errs[i], sub, lno)
+		}
+	}
+}
+
+var condsrc = `
+set a=1
+block input [gamepad: 0]
+if a
+	block x [not input.back]
+	if not b
+		block y [not input.start]
+	else
+		block z [not input.start]
+	end
+else
+	block w [not input.back]
+end
+`
+
+func TestConditionals(t *testing.T) {
+	tests := []struct {
+		defs NamedParam
+		want string
+	}{
+		{nil, "input x y"},
+		{NamedParam{"b": 1}, "input x z"},
+		{NamedParam{"a": 0}, "input w"},
+		{NamedParam{"a": 0, "b": 1}, "input w"},
+	}
+	for _, tt := range tests {
+		p, err := Parse(condsrc, newtestnamespace(), tt.defs)
+		if err != nil {
+			t.Errorf("%v: %v", tt.defs, err)
+			continue
+		}
+		var names []string
+		for _, b := range p.Blocks {
+			names = append(names, b.Name)
+		}
+		gosort.Strings(names)
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("%v: got blocks %s, want %s", tt.defs, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{
+		"else\n",
+		"end\n",
+		"if a\n",
+		"if a\nelse\nelse\nend\n",
+		"if a\nif b\nend\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+var defsrc = `
+def stickfilter(x y: Dz Curve=0.4) -> (x y)
+	block dz [circulardeadzone x y: Dz]
+	block c { x y
+		$[curvature: Curve]
+	}
+	conn c.x dz.x
+	conn c.y dz.y
+	out x c.x
+	out y c.y
+end
+def invert(v) -> (v)
+	out v [not v]
+end
+block input [gamepad: 0]
+block ls [stickfilter input.lx input.ly: 0.1]
+block rs [stickfilter: Dz=0.2 Curve=0.6]
+conn rs.x input.rx
+conn rs.y input.ry
+block joy [vjoy: 1]
+conn joy.x ls.x
+conn joy.y ls.y
+conn joy.rx rs.x
+conn joy.ry rs.y
+conn joy.1 [invert input.back]
+`
+
+func TestDef(t *testing.T) {
+	p, err := Parse(defsrc, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*Blk)
+	for _, b := range p.Blocks {
+		m[b.Name] = b
+	}
+	params := []struct {
+		blk  string
+		want float64
+	}{
+		{"ls/dz", 0.1},
+		{"ls/c#0.x", 0.4},
+		{"rs/dz", 0.2},
+		{"rs/c#0.y", 0.6},
+	}
+	for _, tt := range params {
+		b := m[tt.blk]
+		if b == nil {
+			t.Errorf("block %s missing", tt.blk)
+			continue
+		}
+		if pp, ok := b.Param.(PosParam); !ok || len(pp) != 1 || pp[0] != tt.want {
+			t.Errorf("block %s has param %v, want %v", tt.blk, b.Param, tt.want)
+		}
+	}
+	inputs := []struct {
+		sel, want string
+	}{
+		{"x", "ls/c#0.x"},
+		{"ry", "rs/c#0.y"},
+		{"1", "«invert:25»/«not:13»"},
+	}
+	for _, tt := range inputs {
+		s, ok := m["joy"].Inputs[tt.sel].(*BlkPortSource)
+		if !ok || s.Blk.Name != tt.want {
+			t.Errorf("joy.%s connected to %v, want %s", tt.sel, m["joy"].Inputs[tt.sel], tt.want)
+		}
+	}
+
+	for _, src := range []string{
+		"def f() -> (o)\nend\nblock a [f]\n",
+		"def f(a) -> (a)\n\tout a [f a]\nend\nblock b [f 1]\n",
+		"def f(: A) -> (o)\n\tout o [offset 1: A]\nend\nblock b [f]\n",
+		"def f(a) -> (o)\n\tout o [not a]\nend\nblock b [f]\nblock c [not b]\n",
+		"def f(a) -> (o)\n\tout o [not a]\n",
+		"out o 1\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+
+	src := "block input [gamepad: 0]\ndef db(a) -> (double single)\n\tout double a\n\tout single a\nend\nblock b [not [db input.buttona].dbl]\n"
+	_, err = Parse(src, newtestnamespace(), nil)
+	if errs, ok := err.(ErrorList); !ok || len(errs) != 1 {
+		t.Fatalf("want single error, got %v", err)
+	}
+	if e, ok := err.(ErrorList)[0].(*Error); !ok || e.Line != 6 || e.Col != 33 || e.Hint != "double" {
+		t.Errorf("want error at 6:33 suggesting 'double', got %#v", err.(ErrorList)[0])
+	}
+}
+
+func TestExpr(t *testing.T) {
+	tests := []struct {
+		sel, expr, want string
+	}{
+		{"x", "(input.lx * 0.5 + input.rx)", "add(mul(input.lx 0.5) input.rx)"},
+		{"x", "((input.lx + input.ly) * 2)", "mul(add(input.lx input.ly) 2)"},
+		{"x", "(-input.lx - -1)", "sub(mul(input.lx -1) -1)"},
+		{"x", "(input.lx / 2 % 1)", "mod(div(input.lx 2) 1)"},
+		{"x", "([if input.back input.lx 0] + input.rx)", "add(if(input.back input.lx 0) input.rx)"},
+		{"1", "(input.back && !input.start || input.lthumb)", "or(and(input.back not(input.start)) input.lthumb)"},
+		{"1", "(input.lx < 0.5 && input.ly >= 0.5)", "and(lt(input.lx 0.5) ge(input.ly 0.5))"},
+		{"1", "(input.back &&\n\tinput.start)", "and(input.back input.start)"},
+		{"1", "(input.back == input.start)", "eq(input.back input.start)"},
+		{"1", "(input.back != on || input.lx == 0)", "or(ne(input.back true) eq(input.lx 0))"},
+	}
+	for _, tt := range tests {
+		src := "block input [gamepad: 0]\nblock joy [vjoy: 1]\nconn joy." + tt.sel + " " + tt.expr + "\n"
+		p, err := Parse(src, newtestnamespace(), nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		var got string
+		for _, b := range p.Blocks {
+			if b.Name == "joy" {
+				got = exprstr(b.Inputs[tt.sel])
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{
+		"block input [gamepad: 0]\nblock n [not (input.back &&)]\n",
+		"block input [gamepad: 0]\nblock n [not (input.back && input.start]\n",
+		"block input [gamepad: 0]\nblock n [not (input.back + input.start)]\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+// exprstr formats s, showing operator blocks as function calls.
+func exprstr(s Source) string {
+	switch x := s.(type) {
+	case *BlkPortSource:
+		if !strings.HasPrefix(x.Blk.Name, "«") {
+			return x.Blk.Name + "." + x.Sel
+		}
+		var args []string
+		for _, n := range x.Blk.Type.Input(nil, nil).Names() {
+			if i, ok := x.Blk.Inputs[n]; ok {
+				args = append(args, exprstr(i))
+			}
+		}
+		typ := strings.TrimPrefix(strings.SplitN(x.Blk.Name, ":", 2)[0], "«")
+		return typ + "(" + strings.Join(args, " ") + ")"
+	case *ValueSource:
+		return fmt.Sprint(x.Value)
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+var constsrc = `
+const dz = 0.08
+const fast = dz * 1.5 + 0.01
+set Update=1000
+block input [gamepad: 0]
+block a [deadzone input.lx: Threshold=dz*1.5]
+block b [smooth input.lx: Time=2/Update]
+block c [incremental input.lx: fast -dz (dz + 1)*2]
+`
+
+func TestConst(t *testing.T) {
+	p, err := Parse(constsrc, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Param{
+		"a": NamedParam{"Threshold": 0.12},
+		"b": NamedParam{"Time": 0.002},
+		"c": PosParam{0.13, -0.08, 2.16},
+	}
+	for _, b := range p.Blocks {
+		if w, ok := want[b.Name]; ok && !sameparam(b.Param, w) {
+			t.Errorf("block %s has param %v, want %v", b.Name, b.Param, w)
+		}
+	}
+
+	for _, src := range []string{
+		"const a = 1\nconst a = 2\n",
+		"const a = 1/0\n",
+		"const a = b\n",
+		"const a = (1\n",
+		"block input [gamepad: 0]\nblock a [deadzone input.lx: Threshold=dx]\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+func sameparam(a, b Param) bool {
+	near := func(x, y interface{}) bool {
+		a, ok := x.(float64)
+		b, okb := y.(float64)
+		if !ok || !okb {
+			return fmt.Sprint(x) == fmt.Sprint(y)
+		}
+		return math.Abs(a-b) < 1e-9
+	}
+	switch x := a.(type) {
+	case PosParam:
+		y, ok := b.(PosParam)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !near(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case NamedParam:
+		y, ok := b.(NamedParam)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for n, v := range x {
+			if w, ok := y[n]; !ok || !near(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func TestParamValues(t *testing.T) {
+	src := `
+const dz = 0.1
+const path = "a b.trace"
+set File="x.trace" Curve=quadratic Points={0 0.5 (1 / 2) -dz} Dz=dz Path=path
+`
+	p, err := Parse(src, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewParamReader(nil, p.Config)
+	if got := r.StrArg("File"); got != "x.trace" {
+		t.Errorf("File is %q", got)
+	}
+	if got := r.IdentArg("Curve", "linear", "quadratic"); got != "quadratic" {
+		t.Errorf("Curve is %q", got)
+	}
+	if got := fmt.Sprint(r.ListArg("Points")); got != "[0 0.5 0.5 -0.1]" {
+		t.Errorf("Points is %s", got)
+	}
+	if got := r.Arg("Dz"); got != 0.1 {
+		t.Errorf("Dz is %v", got)
+	}
+	if got := r.StrArg("Path"); got != "a b.trace" {
+		t.Errorf("Path is %q", got)
+	}
+	if got := r.OptIdentArg("Mode", "abs"); got != "abs" {
+		t.Errorf("Mode is %q", got)
+	}
+	if err := r.Err(); err != nil {
+		t.Error(err)
+	}
+
+	for _, f := range []func(ParamReader){
+		func(r ParamReader) { r.Arg("File") },
+		func(r ParamReader) { r.Arg("Curve") },
+		func(r ParamReader) { r.IdentArg("Curve", "linear") },
+		func(r ParamReader) { r.ListArg("File") },
+		func(r ParamReader) { r.StrArg("Points") },
+		func(r ParamReader) { r.StrArg("Missing") },
+	} {
+		r := NewParamReader(nil, p.Config)
+		if f(r); r.Err() == nil {
+			t.Errorf("want error reading %v", p.Config)
+		}
+	}
+}
+
+func TestParamNames(t *testing.T) {
+	src := `
+block input [gamepad: 0]
+block a [deadzone input.lx: Treshold=0.1]
+block b [incremental input.ly: Speed=1 QuickCenter=1]
+`
+	_, err := Parse(src, newtestnamespace(), nil)
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("want single error, got %v", err)
+	}
+	if e := errs[0].(*Error); e.Line != 3 || e.Hint != "Threshold" {
+		t.Errorf("error is %#v, want line 3 hint 'Threshold'", e)
+	}
+}
+
+func TestParamPorts(t *testing.T) {
+	src := `
+block input [gamepad: 0]
+block output [vjoy: 1]
+set TapDelay=0.2 KeepPushed=0.25
+block mybtn [multibutton input.buttona: 3]
+conn output.1 mybtn.3
+conn output.2 mybtn.5
+`
+	_, err := Parse(src, newtestnamespace(), nil)
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("want single error, got %v", err)
+	}
+	if e := errs[0].(*Error); e.Line != 7 || !strings.Contains(e.Msg, "'5'") {
+		t.Errorf("error is %#v, want line 7 output '5'", e)
+	}
+}
+
+func TestPortNames(t *testing.T) {
+	for _, tt := range []struct {
+		src  string
+		want Error
+	}{
+		{"conn output.zz input.lx", Error{Line: 4, Col: 6, Hint: "rz"}},
+		{"conn output.1 input.buttonaa", Error{Line: 4, Col: 15, Hint: "buttona"}},
+		{"for n in 0..1\n\tconn output.$n input.buttona\nend", Error{Line: 5, Col: 7}},
+	} {
+		src := "\nblock input [gamepad: 0]\nblock output [vjoy: 1]\n" + tt.src
+		_, err := Parse(src, newtestnamespace(), nil)
+		errs, ok := err.(ErrorList)
+		if !ok || len(errs) != 1 {
+			t.Errorf("%s: want single error, got %v", tt.src, err)
+			continue
+		}
+		w := tt.want
+		if e := errs[0].(*Error); e.Line != w.Line || e.Col != w.Col || e.Hint != w.Hint {
+			t.Errorf("%s: error is %#v, want line %d col %d hint '%s'", tt.src, e, w.Line, w.Col, w.Hint)
+		}
+	}
+}
+
+const subgraphsrc = `
+block input [gamepad: 0]
+block brakes {
+	in left right
+	out axis brake
+	block t [triggeraxis left right: 0.15 0.05 1.5]
+	block inner {
+		in x
+		out y
+		conn y [multiply x: 2]
+	}
+	conn inner.x t
+	conn axis inner
+	conn brake t.break
+}
+conn brakes.left input.lt
+conn brakes.right input.rt
+block joy [vjoy: 1]
+conn joy.z brakes.axis
+conn joy.1 brakes.brake
+`
+
+func TestSubgraph(t *testing.T) {
+	p, err := Parse(subgraphsrc, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*Blk)
+	for _, b := range p.Blocks {
+		m[b.Name] = b
+	}
+	links := []struct {
+		blk, sel, want string
+	}{
+		{"brakes#t", "left", "input.lt"},
+		{"brakes#t", "right", "input.rt"},
+		{"brakes#inner#«multiply:10»", "", "brakes#t"},
+		{"joy", "z", "brakes#inner#«multiply:10»"},
+		{"joy", "1", "brakes#t.break"},
+	}
+	for _, tt := range links {
+		b := m[tt.blk]
+		if b == nil {
+			t.Errorf("block %s missing", tt.blk)
+			continue
+		}
+		s, ok := b.Inputs[tt.sel].(*BlkPortSource)
+		if ok && s.Sel != "" {
+			ok = s.Blk.Name+"."+s.Sel == tt.want
+		} else if ok {
+			ok = s.Blk.Name == tt.want
+		}
+		if !ok {
+			t.Errorf("%s.%s connected to %v, want %s", tt.blk, tt.sel, b.Inputs[tt.sel], tt.want)
+		}
+	}
+
+	for _, src := range []string{
+		"block g {\n\tin a\n\tout b\n}\n",
+		"block g {\n\tin a\n\tout b\n\tconn b [not a]\n}\nblock c [not g.b]\n",
+		"block g {\n\tin a\n\tout b\n\tconn b [not a]\n}\nconn g.a on\nblock c [not g.c]\n",
+		"block g {\n\tin a a\n}\n",
+		"block g {\n\tout b\n\tconn b 1\n\tconn b 0\n}\n",
+		"block g {\n\tout b\n\tconn b 1\n",
+		"in a\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	src := `
+block input [gamepad: 0]
+block latch [or input.buttona [and prev [not input.buttonb]]]
+block prev [delay latch]
+block output [vjoy: 1]
+conn output.1 latch
+`
+	p, err := Parse(src, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := make(map[string]int)
+	for i, b := range p.Blocks {
+		idx[b.Name] = i
+	}
+	for _, o := range [][2]string{
+		{"prev", "latch"},
+		{"prev", "«and:3»"},
+		{"«and:3»", "latch"},
+		{"latch", "output"},
+	} {
+		if idx[o[0]] >= idx[o[1]] {
+			t.Errorf("block %s sorted after %s", o[0], o[1])
+		}
+	}
+
+	src = `
+block input [gamepad: 0]
+block a [or input.buttona b]
+block b [not c]
+block c [not a]
+block output [vjoy: 1]
+conn output.1 a
+`
+	_, err = Parse(src, newtestnamespace(), nil)
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("want single error, got %v", err)
+	}
+	e := errs[0].(*Error)
+	for _, l := range []string{"a → c", "c → b", "b → a"} {
+		if !strings.Contains(e.Msg, l) {
+			t.Errorf("error is %#v, want loop a → c → b → a", e)
+		}
+	}
+
+	// delay of wrong type in a loop is reported, not the blocks of the loop
+	src = `
+block input [gamepad: 0]
+block latch [or input.buttona [and prev [not input.buttonb]]]
+block prev [sdelay latch]
+block output [vjoy: 1]
+conn output.1 latch
+`
+	_, err = Parse(src, newtestnamespace(), nil)
+	errs, ok = err.(ErrorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("want single error, got %v", err)
+	}
+	if e := errs[0].(*Error); e.Line != 4 || !strings.Contains(e.Msg, "'prev'") {
+		t.Errorf("error is %#v, want line 4 block 'prev'", e)
+	}
+}
+
+const loopsrc = `
+block input [gamepad: 0]
+block output [vjoy: 1]
+const base = 7
+for p in 0..3, s0 in on off on off, s1 in on on off off
+	block plane$p [and [xor input.lbumper $s0] [xor input.rbumper $s1]]
+	block shift$p [offset input.lx: p*0.25]
+end
+for p in 1..3
+	for b in a b x y, n in 0..3
+		conn output.$(base+4*p+n) [if plane$p input.button$b off]
+	end
+end
+for i in
+	conn output.1 nonexistent
+end
+`
+
+func TestLoop(t *testing.T) {
+	p, err := Parse(loopsrc, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*Blk)
+	for _, b := range p.Blocks {
+		m[b.Name] = b
+	}
+	for _, tt := range []struct {
+		sel, cond, then string
+	}{
+		{"11", "plane1", "buttona"},
+		{"14", "plane1", "buttony"},
+		{"15", "plane2", "buttona"},
+		{"22", "plane3", "buttony"},
+	} {
+		s, ok := m["output"].Inputs[tt.sel].(*BlkPortSource)
+		if !ok {
+			t.Errorf("output.%s not connected", tt.sel)
+			continue
+		}
+		c, ok1 := s.Blk.Inputs["cond"].(*BlkPortSource)
+		th, ok2 := s.Blk.Inputs["then"].(*BlkPortSource)
+		if !ok1 || !ok2 || c.Blk.Name != tt.cond || th.Sel != tt.then {
+			t.Errorf("output.%s connected to %v %v, want %s %s", tt.sel,
+				s.Blk.Inputs["cond"], s.Blk.Inputs["then"], tt.cond, tt.then)
+		}
+	}
+	if _, ok := m["output"].Inputs["23"]; ok {
+		t.Errorf("output.23 connected")
+	}
+	if pp, ok := m["shift2"].Param.(PosParam); !ok || len(pp) != 1 || pp[0] != 0.5 {
+		t.Errorf("shift2 has param %v, want 0.5", m["shift2"].Param)
+	}
+
+	for _, src := range []string{
+		"for i in 1..2\nblock a$i [not on]\n",
+		"for i in 1..2, j in 1..3\nend\n",
+		"for i in 1..2\nblock a$j [not on]\nend\n",
+		"for i in 1..2\nblock a [not on]\nend\n",
+		"const i = 1\nfor i in 1..2\nend\n",
+		"for i in 1..2\nend\nblock a$i [not on]\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+const mapsrc = `
+block input [gamepad: 0]
+block output [vjoy: 1]
+block st [stick]
+map st.* input.lx input.ly
+block sq [circlesquare: 0.5]
+map sq.* st.*
+map output.1..4 input.buttona input.buttonb [not input.buttonx] on
+map output.hat1 input.dpad
+`
+
+func TestMap(t *testing.T) {
+	p, err := Parse(mapsrc, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*Blk)
+	for _, b := range p.Blocks {
+		m[b.Name] = b
+	}
+	for _, tt := range []struct {
+		blk, sel, src, srcsel string
+	}{
+		{"st", "x", "input", "lx"},
+		{"st", "y", "input", "ly"},
+		{"sq", "x", "st", "x"},
+		{"sq", "y", "st", "y"},
+		{"output", "1", "input", "buttona"},
+		{"output", "2", "input", "buttonb"},
+		{"output", "hat1", "input", "dpad"},
+	} {
+		s, ok := m[tt.blk].Inputs[tt.sel].(*BlkPortSource)
+		if !ok || s.Blk.Name != tt.src || s.Sel != tt.srcsel {
+			t.Errorf("%s.%s connected to %v, want %s.%s", tt.blk, tt.sel, m[tt.blk].Inputs[tt.sel], tt.src, tt.srcsel)
+		}
+	}
+	if s, ok := m["output"].Inputs["3"].(*BlkPortSource); !ok || !strings.HasPrefix(s.Blk.Name, "«not:") {
+		t.Errorf("output.3 connected to %v, want not block", m["output"].Inputs["3"])
+	}
+	if s, ok := m["output"].Inputs["4"].(*ValueSource); !ok || s.Value != true {
+		t.Errorf("output.4 connected to %v, want true", m["output"].Inputs["4"])
+	}
+
+	for _, src := range []string{
+		"block input [gamepad: 0]\nblock output [vjoy: 1]\nmap output.1..3 input.buttona input.buttonb\n",
+		"block input [gamepad: 0]\nblock output [vjoy: 1]\nmap output.hat1..2 input.buttona input.buttonb\n",
+		"block input [gamepad: 0]\nblock output [vjoy: 1]\nmap output.x..y input.lx input.ly\n",
+		"block input [gamepad: 0]\nblock output [vjoy: 1]\nmap output input.lx\n",
+		"block input [gamepad: 0]\nblock output [vjoy: 1]\nmap output.1..2 inptu.*\n",
+		"block input [gamepad: 0]\nblock output [vjoy: 1]\nmap output.1\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+const inlinesrc = `
+block input [gamepad: 0]
+block output [vjoy: 1]
+def pick(a b) -> (x)
+	out x [if input.buttonx a b]
+end
+conn output.1 [if input.buttona else=input.buttonb then=input.buttonx]
+conn output.2 [triggeraxis left=input.lt right=input.rt: 0.1 0.9 1].break
+conn output.3 [multibutton input.buttony: NumTaps=2 TapDelay=0.2 KeepPushed=0].2
+conn output.4 [pick b=input.buttona a=input.buttonb]
+`
+
+func TestInlineInputs(t *testing.T) {
+	p, err := Parse(inlinesrc, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*Blk)
+	for _, b := range p.Blocks {
+		m[b.Name] = b
+	}
+	out := m["output"].Inputs
+	src := func(s Source) string {
+		if ps, ok := s.(*BlkPortSource); ok {
+			return ps.Blk.Name + "." + ps.Sel
+		}
+		return fmt.Sprint(s)
+	}
+	if s, ok := out["1"].(*BlkPortSource); !ok || src(s.Blk.Inputs["then"]) != "input.buttonx" ||
+		src(s.Blk.Inputs["else"]) != "input.buttonb" || src(s.Blk.Inputs["cond"]) != "input.buttona" {
+		t.Errorf("output.1 connected to %v", out["1"])
+	}
+	if s, ok := out["2"].(*BlkPortSource); !ok || s.Sel != "break" || src(s.Blk.Inputs["right"]) != "input.rt" {
+		t.Errorf("output.2 connected to %v", out["2"])
+	}
+	if s, ok := out["3"].(*BlkPortSource); !ok || s.Sel != "2" {
+		t.Errorf("output.3 connected to %v", out["3"])
+	}
+	if s, ok := out["4"].(*BlkPortSource); !ok || src(s.Blk.Inputs["then"]) != "input.buttonb" ||
+		src(s.Blk.Inputs["else"]) != "input.buttona" {
+		t.Errorf("output.4 connected to %v", out["4"])
+	}
+
+	for _, src := range []string{
+		"block input [gamepad: 0]\nblock a [if input.buttona thne=input.buttonb else=off]\n",
+		"block input [gamepad: 0]\nblock a [if input.buttona cond=input.buttonb]\n",
+		"block input [gamepad: 0]\nblock a [if cond=input.buttona input.buttonb off]\n",
+		"block input [gamepad: 0]\nblock a [not [triggeraxis left=input.lt right=input.rt: 0.1 0.9 1].brake]\n",
+		"block input [gamepad: 0]\nblock b [toggle input.buttona].x\n",
+	} {
+		if _, err := Parse(src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+
+	// bad selectors are reported at their column, but not for the sink
+	_, err = Parse(`
+block input [gamepad: 0]
+block output [vjoy: 1]
+conn output.2 [triggeraxis left=input.lt right=input.rt: 0.1 0.9 1].brake
+`, newtestnamespace(), nil)
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("want single error, got %v", err)
+	}
+	if e := errs[0].(*Error); e.Line != 4 || e.Col != 69 || e.Hint != "break" {
+		t.Errorf("error is %#v, want line 4 col 69 hint 'break'", e)
+	}
+}
+
+func TestLayer(t *testing.T) {
+	const head = "block input [gamepad: 0]\nblock output [vjoy: 1]\n"
+	p, err := Parse(head+`
+layer plane1 input.lbumper !input.rbumper
+	conn output.1 input.buttona
+end
+layer plane2 !input.lbumper input.rbumper
+	map output.1..2 input.buttonb input.buttonx
+end
+layer plane1
+	conn output.hat1 input.dpad
+end
+conn output.2 input.buttony
+conn output.3 plane1
+`, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]*Blk)
+	for _, b := range p.Blocks {
+		m[b.Name] = b
+	}
+	// output.1 is set by plane2 when active, then by plane1, then off
+	s, ok := m["output"].Inputs["1"].(*BlkPortSource)
+	if !ok {
+		t.Fatalf("output.1 connected to %v", m["output"].Inputs["1"])
+	}
+	then, ok1 := s.Blk.Inputs["then"].(*BlkPortSource)
+	els, ok2 := s.Blk.Inputs["else"].(*BlkPortSource)
+	if !ok1 || !ok2 || then.Sel != "buttonb" {
+		t.Fatalf("output.1 selects %v %v", s.Blk.Inputs["then"], s.Blk.Inputs["else"])
+	}
+	if then, ok := els.Blk.Inputs["then"].(*BlkPortSource); !ok || then.Sel != "buttona" {
+		t.Errorf("output.1 selects %v in plane1", els.Blk.Inputs["then"])
+	}
+	if v, ok := els.Blk.Inputs["else"].(*ValueSource); !ok || v.Value != false {
+		t.Errorf("output.1 defaults to %v", els.Blk.Inputs["else"])
+	}
+	// output.2 falls back to its link outside layers
+	s = m["output"].Inputs["2"].(*BlkPortSource)
+	if e, ok := s.Blk.Inputs["else"].(*BlkPortSource); !ok || e.Sel != "buttony" {
+		t.Errorf("output.2 defaults to %v", s.Blk.Inputs["else"])
+	}
+	s = m["output"].Inputs["hat1"].(*BlkPortSource)
+	if v, ok := s.Blk.Inputs["else"].(*ValueSource); !ok || v.Value != hatC {
+		t.Errorf("output.hat1 defaults to %v", s.Blk.Inputs["else"])
+	}
+	if _, ok := m["output"].Inputs["3"].(*BlkPortSource); !ok {
+		t.Errorf("output.3 connected to %v", m["output"].Inputs["3"])
+	}
+
+	// links within defs and groups used in layers are not layered
+	p, err = Parse(head+`
+def inv(x) -> (y)
+	block n [not]
+	conn n x
+	out y n
+end
+layer sh input.lbumper
+	block i [inv input.buttona]
+	block g {
+		in a
+		out b
+		block n [not]
+		conn n a
+		conn b n
+	}
+	conn output.1 i
+	conn output.2 g.b
+end
+conn g.a input.buttonb
+`, newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = make(map[string]*Blk)
+	for _, b := range p.Blocks {
+		m[b.Name] = b
+	}
+	for n, want := range map[string]string{"i/n": "buttona", "g#n": "buttonb"} {
+		if s, ok := m[n].Inputs[""].(*BlkPortSource); !ok || s.Blk.Name != "input" || s.Sel != want {
+			t.Errorf("%s connected to %v, want input.%s", n, m[n].Inputs[""], want)
+		}
+	}
+	if s, ok := m["output"].Inputs["1"].(*BlkPortSource); !ok || s.Blk.TypeName != "if" {
+		t.Errorf("output.1 connected to %v, want layer", m["output"].Inputs["1"])
+	}
+
+	for _, src := range []string{
+		"layer a input.lbumper\nconn output.1 input.buttona\nend\nlayer b input.rbumper\nconn output.1 input.buttonb\nend\n",
+		"layer a input.lbumper\nconn output.1 input.buttona\nconn output.1 input.buttonb\nend\n",
+		"layer a input.lbumper !input.lbumper\nend\n",
+		"layer a\nend\n",
+		"layer a input.lbumper\nend\nlayer a input.rbumper\nend\n",
+		"layer a input.lbumper\nlayer b input.rbumper\nend\nend\n",
+		"layer a input.lbumper\nconn output.1 input.buttona\n",
+	} {
+		if _, err := Parse(head+src, newtestnamespace(), nil); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range []struct{ src, want string }{
+		{"\n\nconn  output.x   input.lx\n\n\n\nconn output.y input.ly   # y\n\n",
+			"conn output.x input.lx\n\nconn output.y input.ly # y\n"},
+		{"conn output.x input.lx\nconn output.hat1 input.dpad\n# rest\nconn output.1 input.a\n",
+			"conn output.x    input.lx\nconn output.hat1 input.dpad\n# rest\nconn output.1 input.a\n"},
+		{"block a [multibutton  [ not input.a ]:NumTaps=2 TapDelay=.40]# a\nblock bb [toggle input.b] # b\n",
+			"block a [multibutton [not input.a]: NumTaps=2 TapDelay=0.4] # a\nblock bb [toggle input.b]                                   # b\n"},
+		{"set A=1000m B=0.0002k C=1500u D=0.5n E=12.50\n",
+			"set A=1 B=200m C=1.5m D=0.5n E=12.5\n"},
+		{"def x(a) -> (b)\nout b [if on a (a && !a)]\nend\n",
+			"def x(a) -> (b)\n\tout b [if on a (a && !a)]\nend\n"},
+		{"for i in 1..2\nlayer l$i input.lbumper\nif c\nconn output.$i [and  input.a   input.b]\nend\nend\nend\n",
+			"for i in 1..2\n\tlayer l$i input.lbumper\n\t\tif c\n\t\tconn output.$i [and input.a input.b]\n\t\tend\n\tend\nend\n"},
+		{"block ls {  x y # ls\n$[deadzone: 0.1]\n\n[stick]\n}  # end\nconn output.x [hatelem input.dpad].n\n",
+			"block ls { x y # ls\n\t$[deadzone: 0.1]\n\n\t[stick]\n} # end\nconn output.x [hatelem input.dpad].n\n"},
+		{"conn output.x [add\n  input.lx\n  input.rx]\n", "conn output.x [add input.lx input.rx]\n"},
+	} {
+		got, err := Format([]byte(tt.src))
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q formatted as\n%s\nwant\n%s", tt.src, got, tt.want)
+		}
+		if again, _ := Format(got); string(again) != string(got) {
+			t.Errorf("%q formatted again as\n%s", tt.src, again)
+		}
+	}
+
+	for _, src := range []string{
+		"conn output.x [add input.lx\n",
+		"conn output.x input.lx]\n",
+		"block a [toggle \"x]\n",
+		"conn output.x [add input.lx # x\n input.rx]\n",
+		"block ls { x y\n[stick]\n",
+	} {
+		if _, err := Format([]byte(src)); err == nil {
+			t.Errorf("%q: want error", src)
+		}
+	}
+}
+
+func TestFormatProfile(t *testing.T) {
+	tm := newtestnamespace()
+	p, err := Parse(string(testsrc), tm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := FormatProfile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := Parse(string(src), tm, nil)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	if len(q.Blocks) != len(p.Blocks) {
+		t.Errorf("profile has %d blocks, written source %d", len(p.Blocks), len(q.Blocks))
+	}
+	again, err := FormatProfile(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(src) {
+		t.Errorf("profile written as\n%s\nparsed and written again as\n%s", src, again)
+	}
+
+	b := &Blk{Name: "b", TypeName: "toggle", Type: tm.m["toggle"]}
+	b.SetInput("", &ValueSource{Value: 3})
+	if _, err := FormatProfile(&Profile{Blocks: []*Blk{b}}); err == nil {
+		t.Error("want error for hat value without name")
+	}
+}
+
+func TestLint(t *testing.T) {
+	p, err := parseprofile("lint.cfg", []byte(`
+block input [gamepad: 0]
+block output [vjoy: 1]
+set Threshold=0.1
+port shift input.lbumper
+port unused input.rbumper
+block dead [not input.buttona]
+block deadend [deadzone: 0.2]
+conn deadend input.lx
+block feed [not input.buttonb]
+block unused2 [and feed input.buttonx]
+conn output.1 [if shift input.buttona input.buttona]
+conn output.2 [if [not on] input.buttona input.buttonb]
+conn output.3 [if input.buttony input.buttona off]
+conn output.x input.lx
+block ramp [incremental 1: Speed=0.5]
+conn output.4 [if (ramp > 0.5) input.buttona off]
+block prev [delay on]
+conn output.5 [if prev input.buttona off]
+`), newtestnamespace(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, w := range lint(p.context) {
+		e := w.(*Error)
+		got = append(got, fmt.Sprintf("%d: %s", e.Line, e.Msg))
+	}
+	want := []string{
+		"3: block 'output' has inputs not connected: y z rx ry rz u v 6..32 hat1..4",
+		"6: port 'unused' not used",
+		"7: block 'dead' not used",
+		"8: block 'deadend' has parameter 'Threshold' given by position, hiding the value of set",
+		"8: block 'deadend' not used",
+		"10: outputs of block 'feed' never reach a sink",
+		"11: block 'unused2' not used",
+		"12: block '«if:12»' has the same source for both branches",
+		"13: block '«if:13»' has constant condition",
+	}
+	gosort.Strings(got)
+	gosort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got warnings\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -2,7 +2,6 @@ package parser
 
 import (
 	"bytes"
-	"fmt"
 	"unicode/utf8"
 )
 
@@ -11,6 +10,10 @@ type sourcereader struct {
 	nline int
 	pline int
 	pos   int
+
+	// subst parses a $ reference within a name or selector,
+	// and returns the text to be used in its place
+	subst func(r *sourcereader) string
 }
 
 func newsourcereader(p []byte) *sourcereader {
@@ -112,8 +115,21 @@ func (r *sourcereader) eat(n string) bool {
 	return false
 }
 
+// at reports if the keyword n is next in the source.
+func (r *sourcereader) at(n string) bool {
+	t := *r
+	return t.eat(n)
+}
+
 // parse number, eat space after value
 func (r *sourcereader) number() float64 {
+	n := r.num()
+	r.skiplinespace()
+	return n
+}
+
+// num parses a number with an optional SI prefix.
+func (r *sourcereader) num() float64 {
 	sign := float64(1)
 	if r.eatch('-') {
 		sign = -1
@@ -142,7 +158,6 @@ func (r *sourcereader) number() float64 {
 	if skip {
 		r.pos += siz
 	}
-	r.skiplinespace()
 	return sign * (float64(n) + float64(fracn)/float64(fracd)) * unit
 }
 
@@ -161,20 +176,44 @@ func (r *sourcereader) digits() (n, d int64) {
 }
 
 func (r *sourcereader) name() string {
-	part := r.src[r.pos:]
-	run, siz := utf8.DecodeRune(part)
-	if !isnamestart(run) {
+	n := r.word(isnamestart, isnamepart)
+	if n == "" {
 		panic("not a name")
 	}
-	i := siz
+	return n
+}
+
+// word reads text starting with a rune for which start reports
+// true, continuing with those for which part does. $ references
+// are substituted if r.subst is set.
+func (r *sourcereader) word(start, part func(rune) bool) string {
+	var buf []byte
 	for {
-		run, siz := utf8.DecodeRune(part[i:])
-		if !isnamepart(run) {
-			break
+		run, siz := utf8.DecodeRune(r.src[r.pos:])
+		switch {
+		case run == '$' && r.subst != nil:
+			buf = append(buf, r.subst(r)...)
+			continue
+		case len(buf) == 0 && !start(run), len(buf) != 0 && !part(run):
+			return string(buf)
 		}
-		i += siz
+		buf = append(buf, r.src[r.pos:r.pos+siz]...)
+		r.pos += siz
+	}
+}
+
+// str reads a string within double quotes. There are no escapes,
+// so that Windows paths can be written as they are.
+func (r *sourcereader) str() string {
+	if !r.eatch('"') {
+		panic("string expected")
 	}
-	r.pos += i
+	part := r.src[r.pos:]
+	i := bytes.IndexAny(part, "\"\n")
+	if i == -1 || part[i] != '"' {
+		panic("unterminated string")
+	}
+	r.pos += i + 1
 	return string(part[:i])
 }
 
@@ -184,37 +223,55 @@ func (r *sourcereader) spec() (name, sel string) {
 		return
 	}
 	if r.eatch('.') {
-		part := r.src[r.pos:]
-		run, siz := utf8.DecodeRune(part)
-		if !isnamestart(run) && !isdigit(run) {
-			panic("invalid selector")
-		}
-		var f func(rune) bool
-		if isdigit(run) {
-			f = isdigit
-		} else {
-			f = isnamepart
-		}
-		i := siz
-		for {
-			run, siz := utf8.DecodeRune(part[i:])
-			if !f(run) {
-				break
-			}
-			i += siz
-		}
-		r.pos += i
-		sel = string(part[:i])
+		sel = r.selector()
 	}
 	return
 }
 
-func (r *sourcereader) formaterror(msg interface{}) error {
-	after := string(r.src[r.pline:r.pos])
-	return fmt.Errorf("line %d: %s... %v", r.nline, after, msg)
+// selector reads a port name following a period.
+func (r *sourcereader) selector() string {
+	var sel string
+	if isdigit(r.ch()) {
+		sel = r.word(isdigit, isdigit)
+	} else {
+		sel = r.word(isnamestart, isnamepart)
+	}
+	if sel == "" {
+		panic("invalid selector")
+	}
+	return sel
 }
 
-type parseerr struct {
+// resync moves to the start of the next statement after an error
+// in the statement starting at start.
+func (r *sourcereader) resync(start int) {
+	// start of line with the error
+	if ls := bytes.LastIndexByte(r.src[:r.pos], '\n') + 1; ls > start {
+		r.pos = ls
+		r.nline = bytes.Count(r.src[:ls], []byte{'\n'})
+		r.pline = ls
+	} else {
+		r.skipline()
+	}
+	for !r.eof() && !r.atstatement() {
+		r.skipline()
+	}
+}
+
+// atstatement reports if a statement, comment or the end
+// of a group starts on the current line.
+func (r *sourcereader) atstatement() bool {
+	t := *r
+	t.skiplinespace()
+	if t.ch() == '#' || t.ch() == '}' {
+		return true
+	}
+	for _, kw := range []string{"include", "set", "const", "def", "for", "layer", "in", "out", "port", "block", "conn", "map", "if", "else", "end"} {
+		if t.eat(kw) {
+			return true
+		}
+	}
+	return false
 }
 
 func isspace(ch rune) bool {
@@ -229,6 +286,11 @@ func isnumstart(ch rune) bool {
 	return isdigit(ch) || ch == '+' || ch == '-' || ch == '.'
 }
 
+// isvaluestart reports if ch can start a parameter value.
+func isvaluestart(ch rune) bool {
+	return isnumstart(ch) || isnamestart(ch) || ch == '(' || ch == '"' || ch == '{'
+}
+
 func isdigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
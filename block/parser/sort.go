@@ -1,20 +1,81 @@
 package parser
 
+import (
+	gosort "sort"
+	"strings"
+)
+
 func sort(ctx *context) error {
 	// check parameters
+	var errs ErrorList
 	for _, blk := range ctx.vblk {
-		if err := blk.Type.Param(blk.Param, ctx.config); err != nil {
-			lno := ctx.blklno[blk]
-			return errf("block '%s' defined on line %d: %s", blk.Name, lno, err)
+		if err := checkparam(blk, ctx.config); err != nil {
+			errs = append(errs, err)
+		} else {
+			blk.globals, blk.paramok = ctx.config, true
+		}
+	}
+
+	// expand map statements, now that ports of blocks are known
+	for _, m := range ctx.maps {
+		v, err := m.links()
+		if err != nil {
+			if err != errBadName {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		ctx.vlink = append(ctx.vlink, v...)
+	}
+
+	// select sources of inputs set within layers
+	vlink, err := mux(ctx, ctx.vlink)
+	if err != nil {
+		errs = append(errs, err.(ErrorList)...)
+	}
+
+	// connect inputs of def instances and groups, and outputs
+	// of groups first, so that links within their bodies can be set up
+	var links []Link
+	for _, c := range vlink {
+		if k, ok := c.sink.(*namedsink); ok {
+			if bound, err := k.bind(c.source); bound {
+				if err != nil {
+					errs = append(errs, c.src.annotate(err.(*Error)))
+				}
+				continue
+			}
+		}
+		links = append(links, c)
+	}
+	for _, g := range ctx.groups {
+		for _, n := range g.def.outputs {
+			if _, ok := g.outputs[n]; !ok {
+				errs = append(errs, g.src.errorat(g.pos, errf("%s of %s not connected", nice(outport, n), g.def)))
+			}
+		}
+	}
+
+	// blocks having errors, blocks using their outputs are not checked
+	badblk := make(map[*Blk]bool)
+	for _, blk := range ctx.vblk {
+		if !blk.paramok {
+			badblk[blk] = true
 		}
 	}
 
 	// set up links and create dependency map
 	dm := make(map[*Blk]int)
 	rm := make(map[*Blk]map[*Blk]bool)
-	var err error
-	for _, c := range ctx.vlink {
-		if err = c.markdep(ctx, func(blk, dep *Blk) {
+	var outputs []linkoutput
+	var linked []linksource
+	for _, c := range links {
+		err := c.markdep(ctx, func(blk, dep *Blk) {
+			if blk.delayed() {
+				// delays use the value of their input from the previous
+				// tick, so they must come before the block providing it
+				blk, dep = dep, blk
+			}
 			if rm[dep] == nil {
 				rm[dep] = make(map[*Blk]bool)
 			}
@@ -22,11 +83,23 @@ func sort(ctx *context) error {
 				rm[dep][blk] = true
 				dm[blk]++
 			}
-		}); err != nil {
-			return err
+		})
+		if err == nil {
+			var s Source
+			if s, err = c.setup(ctx); err == nil {
+				if ps, ok := s.(*BlkPortSource); ok {
+					outputs = append(outputs, linkoutput{c, ps})
+				}
+				linked = append(linked, linksource{c, s})
+			}
 		}
-		if err = c.setup(ctx); err != nil {
-			return err
+		if err != nil {
+			if blk, _ := c.sink.Blk(ctx); blk != nil {
+				badblk[blk] = true
+			}
+			if err != errBadName {
+				errs = append(errs, c.error(err))
+			}
 		}
 	}
 
@@ -55,46 +128,292 @@ func sort(ctx *context) error {
 		}
 
 		if !progress {
-			blk := work[0]
-			return errf("circular dependency on block '%s' defined on line %d", blk.Name, ctx.blklno[blk])
+			return append(errs, cycleError(work, rm))
 		}
 		work, next = next, work[:0]
 	}
 
 	ctx.vblk = done
 
-	// validate block inputs
+	// check outputs used by links, now that parameters are known
+	bad := make(map[Source]bool)
+	for _, o := range outputs {
+		if err := o.check(); err != nil {
+			bad[o.s] = true
+			errs = append(errs, o.c.error(err))
+		}
+	}
+
+	// check delays first, a wrong type of one would show up
+	// as mismatches of links within loops through it
 	for _, blk := range ctx.vblk {
-		lno := ctx.blklno[blk]
-		im, err := blk.InputMap()
-		if err != nil {
-			return errf("block '%s' defined on line %d is incomplete: %v", blk.Name, lno, err)
+		if !blk.delayed() || badblk[blk] || usesbad(blk, bad, badblk) {
+			continue
 		}
-		om, err := blk.Type.Output(im)
-		if err != nil {
-			return errf("block '%s' defined on line %d does not work with input: %v", blk.Name, lno, err)
+		if err := checkdelay(blk); err != nil {
+			badblk[blk] = true
+			errs = append(errs, err)
 		}
-		if blk.oc != nil {
-			for _, n := range blk.oc.sels {
-				if om.Port(n) == Invalid {
-					return errf("block '%s' defined on line %d has no %s: %v",
-						blk.Name, lno, nice(outport, n), blk.oc.reason)
-				}
+	}
+
+	// check types of ports connected by links, so that mismatches
+	// are reported for each link rather than for the block using them
+	for _, l := range linked {
+		if ps, ok := l.s.(*BlkPortSource); bad[l.s] || (ok && badblk[ps.Blk]) {
+			continue
+		}
+		if err := l.check(ctx, badblk); err != nil {
+			bad[l.s] = true
+			errs = append(errs, err)
+		}
+	}
+
+	// validate block inputs, in order so that blocks
+	// are checked after those providing their inputs
+	for _, blk := range ctx.vblk {
+		if badblk[blk] || usesbad(blk, bad, badblk) {
+			badblk[blk] = true
+			continue
+		}
+		if blk.delayed() {
+			continue
+		}
+		if err := checkinputs(blk); err != nil {
+			badblk[blk] = true
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// cycleError reports a loop of blocks in work that has no delay in it.
+// Blocks in work depend on at least one other block in work, rm maps
+// blocks to those depending on them.
+func cycleError(work []*Blk, rm map[*Blk]map[*Blk]bool) error {
+	var path []*Blk
+	seen := make(map[*Blk]int)
+	blk := work[0]
+	for {
+		if i, ok := seen[blk]; ok {
+			path = path[i:]
+			break
+		}
+		seen[blk] = len(path)
+		path = append(path, blk)
+		for _, dep := range work {
+			if rm[dep][blk] {
+				blk = dep
+				break
 			}
 		}
-		for _, p := range blk.Type.Input() {
-			if input, ok := blk.Inputs[p.Name]; ok {
-				pt, err := input.Type()
-				if err != nil {
-					return err
-				}
-				if !Match(pt, p.Type) {
-					return errf("block '%s' type mismatch for %s on line %d: want %s, have %s",
-						blk.Name, nice(inport, p.Name), lno, PortStr(p.Type), PortStr(pt))
-				}
+	}
+	// list blocks in the order values flow
+	names := make([]string, 0, len(path)+1)
+	for i := len(path) - 1; i >= 0; i-- {
+		names = append(names, path[i].Name)
+	}
+	names = append(names, names[0])
+	first := path[len(path)-1]
+	return first.Errorf("circular dependency: %s (use a delay block to break it)", strings.Join(names, " → "))
+}
+
+// linkoutput is a link using an output of a block.
+type linkoutput struct {
+	c Link
+	s *BlkPortSource
+}
+
+// check reports if the output used by o is missing. Errors of the block
+// having the output are not reported, they are found when it is checked,
+// like outputs it must have due to its output constraint.
+func (o linkoutput) check() error {
+	if oc := o.s.Blk.oc; oc != nil && has(oc.sels, o.s.Sel) {
+		return nil
+	}
+	im, err := o.s.Blk.InputMap()
+	if err != nil {
+		return nil
+	}
+	om, err := o.s.Blk.outputs(im)
+	if err != nil {
+		return nil
+	}
+	if om.Port(o.s.Sel) == Invalid {
+		msg := errf("block '%s' has no %s", o.s.Blk.Name, nice(outport, o.s.Sel))
+		p, ok := o.c.source.(positioner)
+		if !ok {
+			return msg
+		}
+		src, pos := p.position()
+		e := src.errorat(pos, msg)
+		e.Hint = suggest(o.s.Sel, om.Names())
+		return e
+	}
+	return nil
+}
+
+// linksource is a link, and the source it set up.
+type linksource struct {
+	c Link
+	s Source
+}
+
+// check reports if the type of the source of l doesn't match the input
+// it is connected to. Sources with errors are not reported, they are
+// found when their block is checked, and so are inputs of any type.
+// Inputs of blocks in badblk are not checked, they were reported already.
+func (l linksource) check(ctx *context, badblk map[*Blk]bool) error {
+	blk, err := l.c.sink.Blk(ctx)
+	if err != nil || blk == nil || badblk[blk] {
+		return nil
+	}
+	sel, ok := inputof(blk, l.s)
+	if !ok {
+		return nil
+	}
+	have, err := l.s.Type()
+	if err != nil {
+		return nil
+	}
+	if want := blk.inputs().Port(sel); want != Invalid && !Match(want, have) {
+		return ctx.linkerror(l.c, errf("can't connect %s to %s of block '%s' needing %s",
+			PortStr(have), nice(inport, sel), blk.Name, PortStr(want)))
+	}
+	return nil
+}
+
+// inputof returns the name of the input of blk set to s.
+func inputof(blk *Blk, s Source) (string, bool) {
+	for n, x := range blk.Inputs {
+		if x == s {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// positioner is implemented by sources knowing where they are given.
+type positioner interface {
+	position() (src *source, pos int)
+}
+
+// usesbad reports if blk has inputs from sources in bad, or from
+// outputs of blocks in badblk. Their errors were reported already.
+func usesbad(blk *Blk, bad map[Source]bool, badblk map[*Blk]bool) bool {
+	for _, s := range blk.Inputs {
+		if bad[s] {
+			return true
+		}
+		if ps, ok := s.(*BlkPortSource); ok && badblk[ps.Blk] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkdelay checks the inputs of delay blk. Its inputs may depend on
+// its own output through a loop, so if its type is not the one its input
+// has, the error would show up in the blocks of the loop. Other types are
+// tried for its output then, and the delay is reported if one matches.
+func checkdelay(blk *Blk) error {
+	err := checkinputs(blk)
+	if err == nil {
+		return nil
+	}
+	if om, oerr := blk.outputs(nil); oerr == nil && len(om) == 1 {
+		for _, pt := range []PortType{Bool, Scalar, Hat} {
+			if pt == om[0].Type {
+				continue
+			}
+			blk.looptype = pt
+			im, ierr := blk.InputMap()
+			blk.looptype = Invalid
+			if ierr == nil && len(im) != 0 && samelooptype(im, pt) {
+				return blk.Errorf("block '%s' has %s type but %s input, their types must match",
+					blk.Name, PortStr(om[0].Type), PortStr(pt))
+			}
+		}
+	}
+	if _, ierr := blk.InputMap(); ierr != nil {
+		// the error is within the loop, and is reported
+		// when the block having it is checked
+		return nil
+	}
+	return err
+}
+
+// samelooptype reports if all ports in im are of type pt.
+func samelooptype(im PortMap, pt PortType) bool {
+	for _, p := range im {
+		if p.Type != pt {
+			return false
+		}
+	}
+	return true
+}
+
+// checkinputs checks the inputs of blk.
+func checkinputs(blk *Blk) error {
+	im, err := blk.InputMap()
+	if err != nil {
+		return blk.Errorf("block '%s' is incomplete: %v", blk.Name, err)
+	}
+	om, err := blk.outputs(im)
+	if err != nil {
+		return blk.Errorf("block '%s' does not work with input: %v", blk.Name, err)
+	}
+	if blk.oc != nil {
+		for _, n := range blk.oc.sels {
+			if om.Port(n) == Invalid {
+				return blk.Errorf("block '%s' has no %s: %v", blk.Name, nice(outport, n), blk.oc.reason)
 			}
 		}
 	}
+	for _, p := range blk.inputs() {
+		if input, ok := blk.Inputs[p.Name]; ok {
+			pt, err := input.Type()
+			if err != nil {
+				return blk.Errorf("%v", err)
+			}
+			if !Match(pt, p.Type) {
+				return blk.Errorf("block '%s' type mismatch for %s: want %s, have %s",
+					blk.Name, nice(inport, p.Name), PortStr(p.Type), PortStr(pt))
+			}
+		}
+	}
+	return nil
+}
 
+// checkparam checks the parameters of blk. Named parameters
+// are checked first against the names its type lists, if any.
+func checkparam(blk *Blk, config NamedParam) error {
+	if pl, ok := blk.Type.(ParamLister); ok {
+		if m, ok := blk.Param.(NamedParam); ok && pl.ParamNames() != nil {
+			names := pl.ParamNames()
+			for _, n := range sortedkeys(m) {
+				if !has(names, n) {
+					e := blk.Errorf("block '%s': unknown parameter '%s'", blk.Name, n)
+					e.Hint = suggest(n, names)
+					return e
+				}
+			}
+		}
+	}
+	if err := blk.Type.Param(blk.Param, config); err != nil {
+		return blk.Errorf("block '%s': %s", blk.Name, err)
+	}
 	return nil
 }
+
+// sortedkeys returns the names in m in order.
+func sortedkeys(m NamedParam) []string {
+	v := make([]string, 0, len(m))
+	for n := range m {
+		v = append(v, n)
+	}
+	gosort.Strings(v)
+	return v
+}
@@ -1,15 +1,25 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 )
 
 type factory struct {
 	tname string
 	typ   Type
+	def   *def // typ is nil for defs
 	param Param
 }
 
+// inputs returns the names of the inputs of f.
+func (f *factory) inputs() []string {
+	if f.def != nil {
+		return f.def.inputs
+	}
+	return f.typ.Input(nil, nil).Names()
+}
+
 type dollarPortMapper struct {
 	lno int
 	m   map[string]*Blk
@@ -93,23 +103,40 @@ func (e *concreteblksource) Source(c *context) (Source, error) {
 	return &BlkPortSource{e.blk, e.sel}, nil
 }
 
-func has(v []string, s string) bool {
-	for _, w := range v {
+// selsource is a named output of a block given inline.
+type selsource struct {
+	concreteblksource
+	src *source
+	pos int // position of the selector
+}
+
+func (e *selsource) position() (*source, int) { return e.src, e.pos }
+
+func has(v []string, s string) bool { return indexof(v, s) != -1 }
+
+// indexof returns the index of s in v, or -1 if v has no s.
+func indexof(v []string, s string) int {
+	for i, w := range v {
 		if s == w {
-			return true
+			return i
 		}
 	}
-	return false
+	return -1
 }
 
 type named struct {
-	lno  int
-	name string
-	sel  string
+	src   *source
+	scope *scope // scope of the statement
+	lno   int
+	pos   int // offset in src
+	name  string
+	sel   string
 }
 
 func (n *named) SrcLine() int { return n.lno }
 
+func (n *named) position() (*source, int) { return n.src, n.pos }
+
 func (n *named) String() string {
 	var sel string
 	if n.sel != "" {
@@ -118,59 +145,105 @@ func (n *named) String() string {
 	return fmt.Sprintf("named@%d:%s%s", n.lno, n.name, sel)
 }
 
-func (n *named) resolve(names portMap) (*Blk, string, error) {
-	if pm, ok := names[n.name]; ok {
+// resolve looks up the port of n using pm, or reports n missing
+// if pm is nil. Names for sinks or sources are suggested in that case.
+func (n *named) resolve(pm portMapper, sink bool) (*Blk, string, error) {
+	if pm != nil {
 		blk, sel, err := pm.port(n.sel)
 		if err != nil {
-			return nil, "", err
+			return nil, "", n.src.errorat(n.pos, err)
 		}
 		return blk, sel, nil
 	}
-	return nil, "", srcerrf(n, "block '%s' missing", n.name)
+	if n.scope.bad(n.name) {
+		return nil, "", errBadName
+	}
+	e := n.src.errorat(n.pos, errf("block '%s' missing", n.name))
+	e.Hint = suggest(n.name, n.scope.names(sink))
+	return nil, "", e
 }
 
-func nsink(lno int, name string, sel string) *namedsink {
-	return &namedsink{named{lno, name, sel}}
-}
+// errBadName is returned when resolving names of blocks or ports
+// that had errors reported already.
+var errBadName = errors.New("name has errors")
 
 type namedsink struct {
 	named
 }
 
 func (k *namedsink) Blk(c *context) (*Blk, error) {
-	blk, _, err := k.resolve(c.sinkNames)
+	pm, _ := k.scope.sink(k.name)
+	blk, _, err := k.resolve(pm, true)
 	return blk, err
 }
 
 func (k *namedsink) SetTo(c *context, s Source) error {
-	blk, sel, err := k.resolve(c.sinkNames)
+	pm, _ := k.scope.sink(k.name)
+	blk, sel, err := k.resolve(pm, true)
 	if err != nil {
 		return err
 	}
+	if blk.paramok {
+		if im := blk.inputs(); im.Port(sel) == Invalid {
+			e := k.src.errorat(k.pos, errf("block '%s' has no %s", blk.Name, nice(inport, sel)))
+			e.Hint = suggest(sel, im.Names())
+			return e
+		}
+	}
 	return blk.SetInput(sel, s)
 }
 
-func nsource(lno int, name string, sel string) *namedsource {
-	return &namedsource{named{lno, name, sel}}
+// bind connects s to the input of a def instance or group k refers to,
+// or sets the output of a group to s within its body. It reports false
+// if k is neither.
+func (k *namedsink) bind(s specSource) (bool, error) {
+	pm, _ := k.scope.sink(k.name)
+	b, ok := pm.(binder)
+	if !ok {
+		return false, nil
+	}
+	if err := b.bind(k.sel, s); err != nil {
+		return true, k.src.errorat(k.pos, err)
+	}
+	return true, nil
+}
+
+// binder is implemented by sinks resolved before links are set up.
+type binder interface {
+	bind(sel string, s specSource) error
 }
 
 type namedsource struct {
 	named
 }
 
+// alias returns what e refers to if it is a port or an output of
+// a def instance. Otherwise it returns the block e refers to, if any.
+func (e *namedsource) alias() (specSource, portMapper) {
+	p, pm := e.scope.source(e.name)
+	if inst, ok := pm.(*instance); ok {
+		return &instoutput{inst, e.sel, e.src, e.pos}, nil
+	}
+	return p, pm
+}
+
 func (e *namedsource) Blk(c *context) (*Blk, error) {
-	if _, ok := c.portNames[e.name]; ok {
-		return nil, nil
+	p, pm := e.alias()
+	if p != nil {
+		c.used[p] = true
+		return p.Blk(c)
 	}
-	blk, _, err := e.resolve(c.sourceNames)
+	blk, _, err := e.resolve(pm, false)
 	return blk, err
 }
 
 func (e *namedsource) Source(c *context) (Source, error) {
-	if p, ok := c.portNames[e.name]; ok {
+	p, pm := e.alias()
+	if p != nil {
+		c.used[p] = true
 		return p.Source(c)
 	}
-	blk, sel, err := e.resolve(c.sourceNames)
+	blk, sel, err := e.resolve(pm, false)
 	if err != nil {
 		return nil, err
 	}
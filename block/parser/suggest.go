@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"strings"
+)
+
+// TypeLister is implemented by TypeMaps that can list the names of their types.
+// The names are used to suggest alternatives for unknown types.
+type TypeLister interface {
+	TypeNames() []string
+}
+
+// suggest returns the name in v most similar to name,
+// or an empty string if none of them are similar enough.
+// Names name is an abbreviation of are suggested too,
+// e.g. "double" for "dbl".
+func suggest(name string, v []string) string {
+	n := len([]rune(name))
+	max := n/3 + 1 // maximum distance allowed
+	if max >= n {
+		max = n - 1
+	}
+	lname := strings.ToLower(name)
+	best, bestd := "", max+1
+	for _, s := range v {
+		if s == name {
+			continue
+		}
+		d := distance(lname, strings.ToLower(s))
+		if d < bestd || (d == bestd && s < best) {
+			best, bestd = s, d
+		}
+	}
+	if best != "" || n < 2 {
+		return best
+	}
+	for _, s := range v {
+		if abbrev(lname, strings.ToLower(s)) && (best == "" || len(s) < len(best) || (len(s) == len(best) && s < best)) {
+			best = s
+		}
+	}
+	return best
+}
+
+// abbrev reports if a is an abbreviation of b, having the
+// first letter of b followed by some of its other letters in order.
+func abbrev(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) >= len(rb) || ra[0] != rb[0] {
+		return false
+	}
+	i := 1
+	for _, r := range rb[1:] {
+		if i < len(ra) && ra[i] == r {
+			i++
+		}
+	}
+	return i == len(ra)
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		diag := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			next := min3(row[j]+1, row[j-1]+1, diag+cost)
+			diag, row[j] = row[j], next
+		}
+	}
+	return row[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// mapnames returns the keys of m.
+func mapnames(m portMap) []string {
+	v := make([]string, 0, len(m))
+	for n := range m {
+		v = append(v, n)
+	}
+	return v
+}
+
+// specnames returns the keys of m.
+func specnames(m map[string]specSource) []string {
+	v := make([]string, 0, len(m))
+	for n := range m {
+		v = append(v, n)
+	}
+	return v
+}
@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"unicode/utf8"
+)
+
+// tokkind is the kind of a token.
+type tokkind int
+
+const (
+	tword   tokkind = iota // names with selectors and $ references
+	tnumber                // numbers with optional SI prefix
+	tstring                // strings within double quotes
+	top                    // operators, brackets and other punctuation
+)
+
+// token is a token of a statement.
+type token struct {
+	pos  int // offset in the source
+	kind tokkind
+	text string
+	sp   bool // preceded by space
+}
+
+// stmt is a statement with its comments, or a comment on its own line.
+// The syntax tree keeps everything needed to write the source back
+// without changing its meaning.
+type stmt struct {
+	pos     int
+	toks    []*token // empty for comment lines
+	comment string   // comment following the statement, or the comment line
+	blank   bool     // preceded by an empty line
+
+	// group braces of block statements
+	group      bool
+	body       []*stmt
+	endcomment string // comment following the closing brace
+}
+
+// keyword returns the first word of s.
+func (s *stmt) keyword() string {
+	if len(s.toks) != 0 && s.toks[0].kind == tword {
+		return s.toks[0].text
+	}
+	return ""
+}
+
+// syntax parses the statements of src. Only the structure of statements
+// is checked, for matching brackets and terminated strings.
+func syntax(src *source) (v []*stmt, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = ErrorList{e}
+		}
+	}()
+	s := &scanner{src: src, b: src.src}
+	return s.stmts(false), nil
+}
+
+// scanner reads the syntax tree of a source.
+type scanner struct {
+	src *source
+	b   []byte
+	pos int
+}
+
+func (s *scanner) ch() rune {
+	r, _ := utf8.DecodeRune(s.b[s.pos:])
+	return r
+}
+
+// peek returns the rune after the current one.
+func (s *scanner) peek() rune {
+	_, siz := utf8.DecodeRune(s.b[s.pos:])
+	r, _ := utf8.DecodeRune(s.b[s.pos+siz:])
+	return r
+}
+
+func (s *scanner) eof() bool { return s.pos >= len(s.b) }
+
+func (s *scanner) next() {
+	_, siz := utf8.DecodeRune(s.b[s.pos:])
+	s.pos += siz
+}
+
+func (s *scanner) fail(pos int, msg string) {
+	panic(s.src.errorat(pos, msg))
+}
+
+// skiplinespace skips spaces, and reports if there were any.
+func (s *scanner) skiplinespace() bool {
+	start := s.pos
+	for !s.eof() && islinespace(s.ch()) {
+		s.next()
+	}
+	return s.pos != start
+}
+
+// comment reads a comment up to the end of the line.
+func (s *scanner) comment() string {
+	start := s.pos
+	for !s.eof() && s.ch() != '\n' {
+		s.next()
+	}
+	return trimright(string(s.b[start:s.pos]))
+}
+
+// stmts reads statements up to the end of the source,
+// or the closing brace of a group.
+func (s *scanner) stmts(group bool) []*stmt {
+	var v []*stmt
+	for {
+		nl := 0
+		for {
+			s.skiplinespace()
+			if s.eof() {
+				break
+			} else if ch := s.ch(); ch == '\n' {
+				nl++
+			} else if ch != ';' {
+				break
+			}
+			s.next()
+		}
+		blank := nl > 1
+		switch {
+		case s.eof():
+			if group {
+				s.fail(s.pos, "unclosed group")
+			}
+			return v
+		case group && s.ch() == '}':
+			s.next()
+			return v
+		case s.ch() == '#':
+			v = append(v, &stmt{pos: s.pos, comment: s.comment(), blank: blank})
+		default:
+			v = append(v, s.stmt(group, blank))
+		}
+	}
+}
+
+// stmt reads a statement.
+func (s *scanner) stmt(group, blank bool) *stmt {
+	st := &stmt{pos: s.pos, blank: blank}
+	var open []*token // open brackets
+	head := false     // in the first line of group braces
+	for {
+		sp := s.skiplinespace()
+		if s.eof() {
+			if len(open) != 0 {
+				s.fail(open[len(open)-1].pos, "unclosed '"+open[len(open)-1].text+"'")
+			}
+			return st
+		}
+		ch := s.ch()
+		if len(open) == 0 || head && len(open) == 1 {
+			switch {
+			case ch == '#':
+				st.comment = s.comment()
+				fallthrough
+			case ch == '\n' || ch == ';':
+				if head {
+					st.group = true
+					st.body = s.stmts(true)
+					s.skiplinespace()
+					if s.ch() == '#' {
+						st.endcomment = s.comment()
+					}
+				}
+				return st
+			case ch == '}' && group && !head:
+				return st
+			}
+		} else if ch == '\n' {
+			s.next()
+			continue
+		} else if ch == '#' {
+			s.fail(s.pos, "comment within brackets")
+		}
+		t := s.token(st)
+		t.sp = sp
+		st.toks = append(st.toks, t)
+		switch t.text {
+		case "[", "(", "{":
+			if t.text == "{" && len(open) == 0 && len(st.toks) == 3 && st.keyword() == "block" {
+				head = true
+			}
+			open = append(open, t)
+		case "]", ")", "}":
+			if len(open) == 0 || closing(open[len(open)-1].text) != t.text {
+				s.fail(t.pos, "unexpected '"+t.text+"'")
+			}
+			open = open[:len(open)-1]
+			if head && len(open) == 0 {
+				// group on a single line
+				head = false
+			}
+		}
+	}
+}
+
+// closing returns the bracket closing the bracket open.
+func closing(open string) string {
+	switch open {
+	case "[":
+		return "]"
+	case "(":
+		return ")"
+	}
+	return "}"
+}
+
+var twocharops = []string{"&&", "||", "==", "!=", "<=", ">=", "->", ".."}
+
+// token reads the next token of st.
+func (s *scanner) token(st *stmt) *token {
+	t := &token{pos: s.pos}
+	// selectors after blocks within brackets, such as [hatelem x].n
+	var prev string
+	if n := len(st.toks); n != 0 && s.pos == st.toks[n-1].pos+len(st.toks[n-1].text) {
+		prev = st.toks[n-1].text
+	}
+	ch := s.ch()
+	switch {
+	case ch == '"':
+		s.next()
+		for !s.eof() && s.ch() != '"' && s.ch() != '\n' {
+			s.next()
+		}
+		if s.ch() != '"' {
+			s.fail(t.pos, "unterminated string")
+		}
+		s.next()
+		t.kind = tstring
+	case ch == '.' && prev == "]":
+		s.next()
+		s.word()
+		t.kind = tword
+	case isdigit(ch) || ch == '.' && isdigit(s.peek()):
+		s.number()
+		t.kind = tnumber
+	case isnamestart(ch) || ch == '$' && (isnamestart(s.peek()) || s.peek() == '('):
+		s.word()
+		t.kind = tword
+	default:
+		t.kind = top
+		for _, op := range twocharops {
+			if s.pos+2 <= len(s.b) && string(s.b[s.pos:s.pos+2]) == op {
+				s.pos += 2
+				t.text = op
+				return t
+			}
+		}
+		s.next()
+	}
+	t.text = string(s.b[t.pos:s.pos])
+	return t
+}
+
+// number reads a number with an optional SI prefix.
+func (s *scanner) number() {
+	for isdigit(s.ch()) {
+		s.next()
+	}
+	if s.ch() == '.' && isdigit(s.peek()) {
+		s.next()
+		for isdigit(s.ch()) {
+			s.next()
+		}
+	}
+	if siprefix(s.ch()) != 0 && !isnamepart(s.peek()) {
+		s.next()
+	}
+}
+
+// word reads names with selectors, ranges and $ references.
+func (s *scanner) word() {
+	for !s.eof() {
+		ch := s.ch()
+		switch {
+		case isnamepart(ch), ch == '.':
+			s.next()
+		case ch == '*' && s.b[s.pos-1] == '.':
+			s.next()
+		case ch == '$' && isnamestart(s.peek()):
+			s.next()
+		case ch == '$' && s.peek() == '(':
+			start := s.pos
+			s.next()
+			depth := 0
+			for {
+				if s.eof() || s.ch() == '\n' {
+					s.fail(start, "unclosed '$('")
+				}
+				switch s.ch() {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+				s.next()
+				if depth == 0 {
+					break
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+// siprefix returns the decimal exponent of the SI prefix ch, or 0 if
+// ch is not one.
+func siprefix(ch rune) int {
+	switch ch {
+	case 'k':
+		return 3
+	case 'm':
+		return -3
+	case 'u', 'μ':
+		return -6
+	case 'n':
+		return -9
+	}
+	return 0
+}
+
+func trimright(s string) string {
+	i := len(s)
+	for i > 0 && (islinespace(rune(s[i-1]))) {
+		i--
+	}
+	return s[:i]
+}
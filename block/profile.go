@@ -1,6 +1,7 @@
 package block
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"time"
@@ -13,14 +14,19 @@ type Profile struct {
 	Blocks  []Block
 	Tickers []Ticker
 	Names   map[Block]string
+	Files   []string // config files, including files included
 }
 
+// Defines are config values set before loading profiles,
+// overriding values from set statements.
+var Defines = make(parser.NamedParam)
+
 func Parse(src string) (*Profile, error) {
 	return ParseProfile(src, DefaultTypeMap)
 }
 
 func ParseProfile(src string, tm TypeMap) (*Profile, error) {
-	p, err := parser.Parse(src, newParserTypeMap(tm))
+	p, err := parser.Parse(src, newParserTypeMap(tm), Defines)
 	if err != nil {
 		return nil, err
 	}
@@ -32,11 +38,22 @@ func Load(fn string) (*Profile, error) {
 }
 
 func LoadProfile(fn string, tm TypeMap) (*Profile, error) {
-	p, err := parser.LoadProfile(fn, newParserTypeMap(tm))
+	p, err := parser.LoadProfile(fn, newParserTypeMap(tm), Defines)
 	if err != nil {
 		return nil, err
 	}
-	return instantiate(p, tm)
+	prof, err := instantiate(p, tm)
+	if err != nil {
+		return nil, err
+	}
+	prof.Files = append([]string{fn}, prof.Files...)
+	return prof, nil
+}
+
+// Lint reports likely mistakes in config fn using DefaultTypeMap,
+// see parser.Lint.
+func Lint(fn string) (parser.ErrorList, error) {
+	return parser.Lint(fn, newParserTypeMap(DefaultTypeMap), Defines)
 }
 
 func (p *Profile) Tick() {
@@ -63,10 +80,7 @@ func (p *Profile) Close() error {
 func instantiate(pprof *parser.Profile, tm TypeMap) (p *Profile, err error) {
 	p = new(Profile)
 	psave := p
-	v, ok := pprof.Config[defaultTickFreqName]
-	if !ok {
-		v = DefaultTickFreq
-	}
+	v := parser.NewParamReader(nil, pprof.Config).OptArg(defaultTickFreqName, DefaultTickFreq)
 	p.D = time.Duration(float64(time.Second) / v)
 	defer func() {
 		if err != nil {
@@ -74,50 +88,40 @@ func instantiate(pprof *parser.Profile, tm TypeMap) (p *Profile, err error) {
 		}
 	}()
 	p.Names = make(map[Block]string)
+	p.Files = pprof.Files
 	mblk := make(map[*parser.Blk]Block)
+	var errs parser.ErrorList
+	var delays []*parser.Blk
 	for _, pb := range pprof.Blocks {
-		ptyp, ok := pb.Type.(*parserType)
-		if !ok {
-			return nil, fmt.Errorf("unexpected type for block '%s'", pb.Name)
+		blk, err := newblock(pb, pprof.Config)
+		if err == nil && !isdelay(pb) {
+			err = connect(pb, blk, mblk)
 		}
-		param := &parseParam{parser.NewParamReader(pb.Param, pprof.Config)}
-		blk, err := ptyp.typ.New(param)
 		if err != nil {
-			return nil, err
-		}
-		if param.Err() != nil {
-			return nil, fmt.Errorf("block '%s' setup error: %v", param.Err())
-		}
-		mblk[pb] = blk
-		for name, port := range pb.Inputs {
-			var p Port
-			switch i := port.(type) {
-			case *parser.BlkPortSource:
-				iblk, ok := mblk[i.Blk]
-				if !ok {
-					return nil, fmt.Errorf("input block '%s' missing", i.Blk.Name)
-				}
-				if p, err = iblk.Output().Get(i.Sel); err != nil {
-					return nil, fmt.Errorf("input port '%s' of block '%s' missing", i.Sel, i.Blk.Name)
-				}
-			case *parser.ValueSource:
-				p = valuePort(i)
-			default:
-				return nil, fmt.Errorf("unexpected input '%s' for block '%s'", name, pb.Name)
-			}
-			if err = blk.Input().Set(name, p); err != nil {
-				return nil, fmt.Errorf("can't set input '%s' on block '%s': %v", name, pb.Name, err)
+			if err != errSkip {
+				errs = append(errs, pb.Errorf("%v", err))
 			}
+			continue
 		}
-		if err = blk.Validate(); err != nil {
-			return nil, fmt.Errorf("loaded block '%s' invalid: %v", pb.Name, err)
+		if isdelay(pb) {
+			// delays come before the blocks providing their input
+			delays = append(delays, pb)
 		}
+		mblk[pb] = blk
 		p.Blocks = append(p.Blocks, blk)
 		p.Names[blk] = pb.Name
 		if t, ok := blk.(Ticker); ok {
 			p.Tickers = append(p.Tickers, t)
 		}
 	}
+	for _, pb := range delays {
+		if err := connect(pb, mblk[pb], mblk); err != nil && err != errSkip {
+			errs = append(errs, pb.Errorf("%v", err))
+		}
+	}
+	if len(errs) != 0 {
+		return nil, errs
+	}
 	runtime.GC()
 	// do a test tick to see if everything is in order
 	if err := testtick(p); err != nil {
@@ -126,6 +130,70 @@ func instantiate(pprof *parser.Profile, tm TypeMap) (p *Profile, err error) {
 	return p, nil
 }
 
+// errSkip is returned by connect for blocks with inputs from invalid blocks.
+var errSkip = errors.New("skipped")
+
+// isdelay reports if pb is a delay.
+func isdelay(pb *parser.Blk) bool {
+	d, ok := pb.Type.(parser.Delayer)
+	return ok && d.Delayed()
+}
+
+// newblock creates the block for pb.
+func newblock(pb *parser.Blk, config parser.NamedParam) (blk Block, err error) {
+	ptyp, ok := pb.Type.(*parserType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type for block '%s'", pb.Name)
+	}
+	param := &parseParam{parser.NewParamReader(pb.Param, config)}
+	if blk, err = ptyp.typ.New(param); err != nil {
+		return nil, fmt.Errorf("block '%s': %v", pb.Name, err)
+	}
+	if param.Err() != nil {
+		closeblk(blk)
+		return nil, fmt.Errorf("block '%s' setup error: %v", pb.Name, param.Err())
+	}
+	return blk, nil
+}
+
+// connect connects the inputs of blk created for pb to
+// blocks in mblk already created, and validates blk.
+func connect(pb *parser.Blk, blk Block, mblk map[*parser.Blk]Block) (err error) {
+	defer func() {
+		if err != nil {
+			closeblk(blk)
+		}
+	}()
+	for _, port := range pb.Inputs {
+		if i, ok := port.(*parser.BlkPortSource); ok {
+			if _, ok := mblk[i.Blk]; !ok {
+				// error reported for i.Blk already
+				return errSkip
+			}
+		}
+	}
+	for name, port := range pb.Inputs {
+		var p Port
+		switch i := port.(type) {
+		case *parser.BlkPortSource:
+			if p, err = mblk[i.Blk].Output().Get(i.Sel); err != nil {
+				return fmt.Errorf("input port '%s' of block '%s' missing", i.Sel, i.Blk.Name)
+			}
+		case *parser.ValueSource:
+			p = valuePort(i)
+		default:
+			return fmt.Errorf("unexpected input '%s' for block '%s'", name, pb.Name)
+		}
+		if err = blk.Input().Set(name, p); err != nil {
+			return fmt.Errorf("can't set input '%s' on block '%s': %v", name, pb.Name, err)
+		}
+	}
+	if err = blk.Validate(); err != nil {
+		return fmt.Errorf("loaded block '%s' invalid: %v", pb.Name, err)
+	}
+	return nil
+}
+
 func testtick(p *Profile) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
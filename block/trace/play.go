@@ -0,0 +1,162 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
+)
+
+func init() {
+	block.RegisterParam("replay", func(p block.Param) (block.Block, error) {
+		if p == block.ProtoParam {
+			return device.NewGamepadBlock("replay", nil), nil
+		}
+		pl, ok := device.Default.(*Player)
+		if !ok {
+			return nil, errors.New("'replay' needs a trace to play")
+		}
+		g, err := pl.OpenGamepad(int(p.OptArg("device", 0)))
+		if err != nil {
+			return nil, err
+		}
+		return device.NewGamepadBlock("replay", g), nil
+	}, block.Opt("device", block.Number, 0, 0, 3))
+	block.Describe("replay", &block.TypeDoc{
+		Category: "Device blocks",
+		Summary:  "gamepad input played back from a trace",
+		Text: "`replay` has the same outputs as `gamepad`, but the values are played back from the trace " +
+			"specified using `-replay`. Loading a config using `replay` fails in normal operation.",
+		Params: map[string]string{"device": "recorded gamepad to use, 0 is the first one"},
+	})
+}
+
+// Player is a device.Backend that plays back gamepads recorded
+// by Recorder. The trace is played using a virtual clock
+// adjusted with Advance.
+type Player struct {
+	device.Backend
+
+	r      *Reader
+	values []interface{} // current values
+
+	next    int64         // tick of next frame
+	nvalues []interface{} // values of next frame
+	eof     bool
+	last    int64 // tick of last frame read
+}
+
+// NewPlayer returns a Player that plays back gamepads from r,
+// and opens joysticks using b.
+func NewPlayer(b device.Backend, r *Reader) (*Player, error) {
+	p := &Player{Backend: b, r: r, values: r.ZeroValues()}
+	if err := p.read(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewIdlePlayer returns a Player with gamepads 0..n-1 in their
+// initial state, and opens joysticks using b. It is useful for
+// setting up profiles that have replay blocks without a trace.
+func NewIdlePlayer(b device.Backend, n int) *Player {
+	r := new(Reader)
+	var s device.GamepadState
+	for i := 0; i < n; i++ {
+		for _, d := range s.Ports() {
+			r.Channels = append(r.Channels, Channel{fmt.Sprintf("gamepad%d.%s", i, d.N), block.TypeOf(d.V)})
+		}
+	}
+	r.Tick = time.Millisecond
+	return &Player{Backend: b, r: r, values: r.ZeroValues(), eof: true}
+}
+
+// Header returns the header of the trace played.
+func (p *Player) Header() *Header { return &p.r.Header }
+
+// Advance updates values of gamepads to the time t relative to the start of the trace.
+func (p *Player) Advance(t time.Duration) error {
+	for !p.eof && p.r.Time(p.next) <= t {
+		copy(p.values, p.nvalues)
+		p.last = p.next
+		if err := p.read(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Done reports if the time t is past the end of the trace.
+func (p *Player) Done(t time.Duration) bool {
+	return p.eof && p.r.Time(p.last) < t
+}
+
+func (p *Player) read() error {
+	tick, values, err := p.r.Next()
+	if err == io.EOF {
+		p.eof = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.next, p.nvalues = tick, values
+	return nil
+}
+
+func (p *Player) OpenGamepad(dev int) (device.Gamepad, error) {
+	if dev < 0 || dev >= device.NumGamepads {
+		return nil, fmt.Errorf("invalid gamepad device %d", dev)
+	}
+	g := &playgamepad{p: p}
+	var s device.GamepadState
+	found := false
+	for _, d := range s.Ports() {
+		idx := p.r.Index(fmt.Sprintf("gamepad%d.%s", dev, d.N))
+		if idx >= 0 {
+			if p.r.Channels[idx].Type != block.TypeOf(d.V) {
+				return nil, fmt.Errorf("trace channel '%s' has invalid type", p.r.Channels[idx].Name)
+			}
+			found = true
+		}
+		g.idx = append(g.idx, idx)
+	}
+	if !found {
+		return nil, fmt.Errorf("trace has no gamepad %d", dev)
+	}
+	return g, nil
+}
+
+type playgamepad struct {
+	p   *Player
+	idx []int // channel index for each of GamepadState.Ports()
+
+	s     *device.GamepadState // last state read
+	ports []block.MapDecl      // ports of s
+}
+
+func (g *playgamepad) Read(s *device.GamepadState) error {
+	if g.s != s {
+		g.s, g.ports = s, s.Ports()
+	}
+	for i, d := range g.ports {
+		idx := g.idx[i]
+		if idx < 0 {
+			continue
+		}
+		switch x := d.V.(type) {
+		case *bool:
+			*x = g.p.values[idx].(bool)
+		case *float64:
+			*x = g.p.values[idx].(float64)
+		case *int:
+			*x = g.p.values[idx].(int)
+		}
+	}
+	return nil
+}
+
+func (g *playgamepad) Close() error { return nil }
@@ -0,0 +1,136 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// Reader reads a trace.
+type Reader struct {
+	Header
+
+	r      *bufio.Reader
+	tick   int64
+	values []interface{}
+	buf    [8]byte
+}
+
+// NewReader reads the trace header from r, and returns a Reader
+// for reading frames.
+func NewReader(r io.Reader) (*Reader, error) {
+	tr := &Reader{r: bufio.NewReader(r)}
+	var m [len(magic) + 1]byte
+	if _, err := io.ReadFull(tr.r, m[:]); err != nil {
+		return nil, eofFormat(err)
+	}
+	if string(m[:len(magic)]) != magic {
+		return nil, ErrFormat
+	}
+	if m[len(magic)] != Version {
+		return nil, ErrVersion
+	}
+	tick, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return nil, eofFormat(err)
+	}
+	tr.Tick = time.Duration(tick)
+	start, err := binary.ReadVarint(tr.r)
+	if err != nil {
+		return nil, eofFormat(err)
+	}
+	if start != 0 {
+		tr.Start = time.Unix(0, start)
+	}
+	nchan, err := tr.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < nchan; i++ {
+		code, err := tr.r.ReadByte()
+		if err != nil {
+			return nil, eofFormat(err)
+		}
+		t, err := porttype(code)
+		if err != nil {
+			return nil, err
+		}
+		n, err := tr.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(tr.r, name); err != nil {
+			return nil, eofFormat(err)
+		}
+		tr.Channels = append(tr.Channels, Channel{string(name), t})
+	}
+	tr.values = tr.ZeroValues()
+	return tr, nil
+}
+
+// Next reads the next frame. It returns the tick of the frame, and
+// the values of all channels at that tick. The values slice is reused
+// by subsequent calls. Next returns io.EOF at the end of the trace.
+func (r *Reader) Next() (tick int64, values []interface{}, err error) {
+	dtick, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, eofFormat(err)
+	}
+	nchange, err := r.uvarint()
+	if err != nil {
+		return 0, nil, err
+	}
+	for i := 0; i < nchange; i++ {
+		idx, err := r.uvarint()
+		if err != nil {
+			return 0, nil, err
+		}
+		if idx >= len(r.values) {
+			return 0, nil, ErrFormat
+		}
+		switch r.values[idx].(type) {
+		case bool, int:
+			b, err := r.r.ReadByte()
+			if err != nil {
+				return 0, nil, eofFormat(err)
+			}
+			if _, isbool := r.values[idx].(bool); isbool {
+				r.values[idx] = b != 0
+			} else {
+				r.values[idx] = int(b)
+			}
+		case float64:
+			if _, err := io.ReadFull(r.r, r.buf[:8]); err != nil {
+				return 0, nil, eofFormat(err)
+			}
+			r.values[idx] = math.Float64frombits(binary.LittleEndian.Uint64(r.buf[:8]))
+		}
+	}
+	r.tick += int64(dtick)
+	return r.tick, r.values, nil
+}
+
+func (r *Reader) uvarint() (int, error) {
+	v, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return 0, eofFormat(err)
+	}
+	if v > math.MaxInt32 {
+		return 0, ErrFormat
+	}
+	return int(v), nil
+}
+
+// eofFormat reports unexpected end of input as ErrFormat.
+func eofFormat(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrFormat
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
+)
+
+// Recorder is a device.Backend that records the state of gamepads
+// opened through it. Channels are named "gamepadN.port", where N is
+// the device number and port is an output of the gamepad block.
+type Recorder struct {
+	device.Backend
+
+	// Tick is the tick duration written to the trace header.
+	// It must be set before the first call to Record.
+	Tick time.Duration
+
+	w  io.Writer
+	tw *Writer
+
+	pads   map[int]*device.GamepadState
+	ports  []interface{} // recorded GamepadState fields
+	values []interface{}
+}
+
+// NewRecorder returns a Recorder that opens devices using b,
+// and writes the trace to w.
+func NewRecorder(b device.Backend, w io.Writer) *Recorder {
+	return &Recorder{
+		Backend: b,
+		w:       w,
+		pads:    make(map[int]*device.GamepadState),
+	}
+}
+
+func (r *Recorder) OpenGamepad(dev int) (device.Gamepad, error) {
+	g, err := r.Backend.OpenGamepad(dev)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := r.pads[dev]
+	if !ok {
+		s = new(device.GamepadState)
+		r.pads[dev] = s
+	}
+	return &recgamepad{g, s}, nil
+}
+
+// Record writes the state of the gamepads as tick. The trace header
+// is written upon the first call, gamepads opened later are not recorded.
+func (r *Recorder) Record(tick int64) error {
+	if r.tw == nil {
+		if err := r.start(); err != nil {
+			return err
+		}
+	}
+	for i, p := range r.ports {
+		switch x := p.(type) {
+		case *bool:
+			r.values[i] = *x
+		case *float64:
+			r.values[i] = *x
+		case *int:
+			r.values[i] = *x
+		}
+	}
+	return r.tw.Write(tick, r.values)
+}
+
+// Close ends the trace. It closes the underlying io.Writer if it is an io.Closer.
+func (r *Recorder) Close() error {
+	var err error
+	if r.tw != nil {
+		err = r.tw.Close()
+	}
+	if c, ok := r.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (r *Recorder) start() error {
+	var devs []int
+	for dev := range r.pads {
+		devs = append(devs, dev)
+	}
+	sort.Ints(devs)
+	h := &Header{Tick: r.Tick, Start: time.Now()}
+	for _, dev := range devs {
+		for _, d := range r.pads[dev].Ports() {
+			h.Channels = append(h.Channels, Channel{fmt.Sprintf("gamepad%d.%s", dev, d.N), block.TypeOf(d.V)})
+			r.ports = append(r.ports, d.V)
+		}
+	}
+	r.values = h.ZeroValues()
+	var err error
+	r.tw, err = NewWriter(r.w, h)
+	return err
+}
+
+type recgamepad struct {
+	device.Gamepad
+	s *device.GamepadState
+}
+
+func (g *recgamepad) Read(s *device.GamepadState) error {
+	err := g.Gamepad.Read(s)
+	*g.s = *s
+	return err
+}
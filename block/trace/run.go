@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tajtiattila/joyster/block"
+)
+
+// Sinks returns the channels for the inputs of sink blocks in prof,
+// that is blocks without outputs. Channels are named "block.port".
+func Sinks(prof *block.Profile) []Channel {
+	var v []Channel
+	for _, blk := range prof.Blocks {
+		if !issink(blk) {
+			continue
+		}
+		im := blk.Input()
+		for _, n := range im.Names() {
+			v = append(v, Channel{prof.Names[blk] + "." + n, im.Type(n)})
+		}
+	}
+	return v
+}
+
+// Run runs prof with a virtual clock until the end of the trace
+// played by p, and returns the number of ticks run. Prof must have
+// been loaded with p as device.Default. If w is not nil, the inputs
+// of the sink blocks of prof are written to w as a trace.
+func Run(prof *block.Profile, p *Player, w io.Writer) (n int64, err error) {
+	var (
+		tw     *Writer
+		ports  []block.IO
+		sels   []string
+		values []interface{}
+	)
+	if w != nil {
+		h := &Header{Tick: prof.D, Start: p.Header().Start, Channels: Sinks(prof)}
+		if tw, err = NewWriter(w, h); err != nil {
+			return 0, err
+		}
+		for _, blk := range prof.Blocks {
+			if issink(blk) {
+				im := blk.Input()
+				for _, sel := range im.Names() {
+					ports, sels = append(ports, im), append(sels, sel)
+				}
+			}
+		}
+		values = make([]interface{}, len(ports))
+	}
+	for ; ; n++ {
+		t := time.Duration(n) * prof.D
+		if err = p.Advance(t); err != nil {
+			return n, err
+		}
+		if p.Done(t) {
+			break
+		}
+		prof.Tick()
+		if tw != nil {
+			for i, im := range ports {
+				values[i] = im.Value(sels[i])
+			}
+			if err = tw.Write(n, values); err != nil {
+				return n, fmt.Errorf("tick %d: %v", n, err)
+			}
+		}
+	}
+	if tw != nil {
+		err = tw.Close()
+	}
+	return n, err
+}
+
+func issink(blk block.Block) bool {
+	om := blk.Output()
+	return blk.Input() != nil && (om == nil || len(om.Names()) == 0)
+}
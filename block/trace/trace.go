@@ -0,0 +1,127 @@
+// Package trace reads and writes joyster trace files.
+//
+// A trace is a sequence of port values sampled upon profile ticks.
+// Only changes are stored, so idle periods take up no space.
+//
+// The file starts with a header, followed by frames. Integers are
+// stored as unsigned varints (encoding/binary) unless noted otherwise.
+//
+//	header:
+//		magic    "JYTRACE" (7 bytes)
+//		version  1 byte, currently 1
+//		tick     duration of one tick in nanoseconds
+//		start    start time in Unix nanoseconds (signed varint)
+//		nchan    number of channels
+//		channels nchan × channel
+//	channel:
+//		type     1 byte: 1 - bool, 2 - axis, 3 - hat
+//		namelen  length of name
+//		name     namelen bytes, UTF-8
+//	frame:
+//		dtick    ticks elapsed since the previous frame (or tick 0)
+//		nchange  number of changed channels
+//		changes  nchange × change
+//	change:
+//		index    channel index
+//		value    bool and hat: 1 byte, axis: IEEE 754 float64, little endian
+//
+// Channels have zero values (off, 0 and centre) before their first change.
+// The last frame may have no changes, it marks the end of the trace.
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tajtiattila/joyster/block"
+)
+
+const (
+	magic   = "JYTRACE"
+	Version = 1
+)
+
+const (
+	typeBool = 1
+	typeAxis = 2
+	typeHat  = 3
+)
+
+var (
+	ErrFormat  = errors.New("trace: invalid format")
+	ErrVersion = errors.New("trace: unsupported version")
+)
+
+// Channel is a recorded port.
+type Channel struct {
+	Name string
+	Type block.PortType
+}
+
+// Header describes the contents of a trace.
+type Header struct {
+	Tick     time.Duration // duration of one tick
+	Start    time.Time     // time of tick 0
+	Channels []Channel
+}
+
+// Time returns the time of tick relative to the start of the trace.
+func (h *Header) Time(tick int64) time.Duration {
+	return time.Duration(tick) * h.Tick
+}
+
+// Index returns the index of the channel name, or -1 if h has no such channel.
+func (h *Header) Index(name string) int {
+	for i, c := range h.Channels {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ZeroValues returns the initial values for channels in h.
+func (h *Header) ZeroValues() []interface{} {
+	v := make([]interface{}, len(h.Channels))
+	for i, c := range h.Channels {
+		v[i] = zero(c.Type)
+	}
+	return v
+}
+
+func zero(t block.PortType) interface{} {
+	switch t {
+	case block.Bool:
+		return false
+	case block.Float64:
+		return float64(0)
+	case block.Int:
+		return int(0)
+	}
+	return nil
+}
+
+func typecode(t block.PortType) (byte, error) {
+	switch t {
+	case block.Bool:
+		return typeBool, nil
+	case block.Float64:
+		return typeAxis, nil
+	case block.Int:
+		return typeHat, nil
+	}
+	return 0, fmt.Errorf("trace: invalid channel type %v", t)
+}
+
+func porttype(code byte) (block.PortType, error) {
+	switch code {
+	case typeBool:
+		return block.Bool, nil
+	case typeAxis:
+		return block.Float64, nil
+	case typeHat:
+		return block.Int, nil
+	}
+	return block.Invalid, ErrFormat
+}
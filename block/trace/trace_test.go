@@ -0,0 +1,216 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
+	_ "github.com/tajtiattila/joyster/block/device/vjoy"
+	_ "github.com/tajtiattila/joyster/block/device/xinput"
+)
+
+func TestReadWrite(t *testing.T) {
+	h := &Header{
+		Tick:  time.Millisecond,
+		Start: time.Unix(1400000000, 0),
+		Channels: []Channel{
+			{"pad.a", block.Bool},
+			{"pad.lx", block.Float64},
+			{"pad.dpad", block.Int},
+		},
+	}
+	frames := []struct {
+		tick   int64
+		values []interface{}
+	}{
+		{0, []interface{}{true, 0.0, 0}},
+		{5, []interface{}{true, -0.25, 0}},
+		{7, []interface{}{false, -0.25, block.HatNorth | block.HatWest}},
+		{1000, []interface{}{false, 1.0, block.HatCentre}},
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		if err := w.Write(f.tick, f.values); err != nil {
+			t.Fatal(err)
+		}
+		// unchanged values are not stored
+		if err := w.Write(f.tick+1, f.values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Tick != h.Tick || !r.Start.Equal(h.Start) || !reflect.DeepEqual(r.Channels, h.Channels) {
+		t.Errorf("header mismatch: got %+v, want %+v", r.Header, *h)
+	}
+	for _, f := range frames {
+		tick, values, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != f.tick || !reflect.DeepEqual(values, f.values) {
+			t.Errorf("frame mismatch: got %d %v, want %d %v", tick, values, f.tick, f.values)
+		}
+	}
+	tick, _, err := r.Next()
+	if err != nil || tick != 1001 {
+		t.Errorf("end frame: got %d %v, want 1001", tick, err)
+	}
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Errorf("want EOF, got %v", err)
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	h := &Header{Tick: time.Millisecond, Channels: []Channel{{"a", block.Bool}}}
+	w, err := NewWriter(new(bytes.Buffer), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(0, []interface{}{1.0}); err == nil {
+		t.Error("invalid value type accepted")
+	}
+	if err := w.Write(3, []interface{}{true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(3, []interface{}{false}); err == nil {
+		t.Error("repeated tick accepted")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	fake := device.NewFake()
+	buf := new(bytes.Buffer)
+	rec := NewRecorder(fake, buf)
+	rec.Tick = time.Millisecond
+
+	g, err := rec.OpenGamepad(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s device.GamepadState
+	for tick := int64(0); tick < 10; tick++ {
+		fake.Gamepad(1).State.LX = float64(tick+1) / 10
+		g.Read(&s)
+		if err := rec.Record(tick); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := r.Index("gamepad1.lx")
+	if idx < 0 || len(r.Channels) != len(s.Ports()) {
+		t.Fatalf("unexpected channels: %v", r.Channels)
+	}
+	for want := int64(0); want < 10; want++ {
+		tick, values, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != want || values[idx] != float64(want+1)/10 {
+			t.Errorf("got %v at tick %d, want %v at %d", values[idx], tick, float64(want+1)/10, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	// input trace: 2 ticks per millisecond
+	h := &Header{Tick: time.Millisecond / 2, Channels: []Channel{
+		{"gamepad0.a", block.Bool},
+		{"gamepad0.lx", block.Float64},
+	}}
+	in := new(bytes.Buffer)
+	w, err := NewWriter(in, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(2, []interface{}{true, 0.5})
+	w.Write(6, []interface{}{false, -0.5})
+	w.Write(9, []interface{}{false, -0.5})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, typ := range []string{"gamepad", "replay"} {
+		r, err := NewReader(bytes.NewReader(in.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		player, err := NewPlayer(device.NewFake(), r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := device.Default
+		device.Default = player
+		prof, err := block.Parse(`
+set Update=1000
+block input [` + typ + `]
+block output [vjoy]
+conn output.x input.lx
+conn output.1 input.a
+`)
+		device.Default = saved
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := new(bytes.Buffer)
+		n, err := Run(prof, player, out)
+		prof.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 {
+			t.Errorf("%s: %d ticks run, want 5", typ, n)
+		}
+
+		or, err := NewReader(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix, i1 := or.Index("output.x"), or.Index("output.1")
+		if ix < 0 || i1 < 0 || or.Tick != time.Millisecond {
+			t.Fatalf("%s: unexpected output header %+v", typ, or.Header)
+		}
+		want := []struct {
+			tick int64
+			x    float64
+			b    bool
+		}{
+			{1, 0.5, true},
+			{3, -0.5, false},
+			{4, -0.5, false},
+		}
+		for _, f := range want {
+			tick, values, err := or.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tick != f.tick || values[ix] != f.x || values[i1] != f.b {
+				t.Errorf("%s: got %v %v at tick %d, want %v %v at %d",
+					typ, values[ix], values[i1], tick, f.x, f.b, f.tick)
+			}
+		}
+	}
+}
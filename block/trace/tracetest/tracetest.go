@@ -0,0 +1,229 @@
+// Package tracetest implements golden trace tests for profiles.
+//
+// A profile is run against an input trace, and its output is compared
+// to a golden trace file. Golden files are regenerated instead
+// when tests are run with the -update flag:
+//
+//	go test -update
+package tracetest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
+	"github.com/tajtiattila/joyster/block/trace"
+)
+
+var update = flag.Bool("update", false, "update golden trace files")
+
+// MaxDiff is the maximum number of differences reported by Golden.
+var MaxDiff = 10
+
+// Run parses the profile src using tm, runs it against the trace in file input
+// and returns the resulting output trace.
+func Run(src string, tm block.TypeMap, input string) ([]byte, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := trace.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", input, err)
+	}
+	player, err := trace.NewPlayer(device.NewFake(), r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", input, err)
+	}
+
+	saved := device.Default
+	device.Default = player
+	prof, err := block.ParseProfile(src, tm)
+	device.Default = saved
+	if err != nil {
+		return nil, err
+	}
+	defer prof.Close()
+
+	out := new(bytes.Buffer)
+	if _, err := trace.Run(prof, player, out); err != nil {
+		return nil, fmt.Errorf("%s: %v", input, err)
+	}
+	return out.Bytes(), nil
+}
+
+// Golden runs the profile src using tm against the trace in file input,
+// and compares the output with the trace in file golden.
+func Golden(t testing.TB, src string, tm block.TypeMap, input, golden string) {
+	t.Helper()
+	got, err := Run(src, tm, input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0666); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Errorf("%v (use -update to create golden files)", err)
+		return
+	}
+	diff, err := Diff(bytes.NewReader(got), bytes.NewReader(want))
+	if err != nil {
+		t.Errorf("%s: %v", golden, err)
+		return
+	}
+	for i, d := range diff {
+		if i == MaxDiff {
+			t.Errorf("%s: %d more differences", golden, len(diff)-i)
+			break
+		}
+		t.Errorf("%s: %s", golden, d)
+	}
+}
+
+// Diff compares traces got and want, and returns their differences
+// in human readable form.
+func Diff(got, want io.Reader) ([]string, error) {
+	gr, err := trace.NewReader(got)
+	if err != nil {
+		return nil, err
+	}
+	wr, err := trace.NewReader(want)
+	if err != nil {
+		return nil, err
+	}
+	var diff []string
+	if gr.Tick != wr.Tick {
+		diff = append(diff, fmt.Sprintf("tick duration is %v, want %v", gr.Tick, wr.Tick))
+	}
+	gidx := make([]int, len(wr.Channels))
+	for i, c := range wr.Channels {
+		gidx[i] = gr.Index(c.Name)
+		switch {
+		case gidx[i] < 0:
+			diff = append(diff, fmt.Sprintf("channel '%s' missing", c.Name))
+		case gr.Channels[gidx[i]].Type != c.Type:
+			diff = append(diff, fmt.Sprintf("channel '%s' type mismatch", c.Name))
+			gidx[i] = -1
+		}
+	}
+	for _, c := range gr.Channels {
+		if wr.Index(c.Name) < 0 {
+			diff = append(diff, fmt.Sprintf("unexpected channel '%s'", c.Name))
+		}
+	}
+
+	// compare values at ticks where either trace has a frame
+	gs, err := newstream(gr)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := newstream(wr)
+	if err != nil {
+		return nil, err
+	}
+	for !gs.eof || !ws.eof {
+		var tick int64
+		switch {
+		case gs.eof:
+			tick = ws.next
+		case ws.eof:
+			tick = gs.next
+		default:
+			tick = gs.next
+			if ws.next < tick {
+				tick = ws.next
+			}
+		}
+		if err := gs.advance(tick); err != nil {
+			return nil, err
+		}
+		if err := ws.advance(tick); err != nil {
+			return nil, err
+		}
+		for i, c := range wr.Channels {
+			if gidx[i] < 0 {
+				continue
+			}
+			g, w := gs.values[gidx[i]], ws.values[i]
+			if !equal(g, w) {
+				diff = append(diff, fmt.Sprintf("tick %d (%v): '%s' is %v, want %v",
+					tick, wr.Time(tick), c.Name, g, w))
+			}
+		}
+	}
+	if gs.last != ws.last {
+		diff = append(diff, fmt.Sprintf("trace ends at tick %d, want %d", gs.last, ws.last))
+	}
+	return diff, nil
+}
+
+// epsilon is the tolerance for axis values, so that golden files
+// are portable across platforms with different floating point rounding.
+const epsilon = 1e-9
+
+func equal(a, b interface{}) bool {
+	fa, aok := a.(float64)
+	fb, bok := b.(float64)
+	if aok && bok {
+		return math.Abs(fa-fb) <= epsilon || (math.IsNaN(fa) && math.IsNaN(fb))
+	}
+	return a == b
+}
+
+// stream reads frames from a trace with one frame lookahead.
+type stream struct {
+	r      *trace.Reader
+	values []interface{} // values at last
+	last   int64         // tick of values
+
+	next    int64 // tick of next frame
+	nvalues []interface{}
+	eof     bool
+}
+
+func newstream(r *trace.Reader) (*stream, error) {
+	s := &stream{r: r, values: r.ZeroValues()}
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *stream) read() error {
+	tick, values, err := s.r.Next()
+	if err == io.EOF {
+		s.eof = true
+		return nil
+	}
+	if err != nil {
+		s.eof = true
+		return err
+	}
+	s.next, s.nvalues = tick, values
+	return nil
+}
+
+func (s *stream) advance(tick int64) error {
+	for !s.eof && s.next <= tick {
+		copy(s.values, s.nvalues)
+		s.last = s.next
+		if err := s.read(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
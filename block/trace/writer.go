@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/tajtiattila/joyster/block"
+)
+
+// Writer writes a trace.
+type Writer struct {
+	h *Header
+	w *bufio.Writer
+
+	last   []interface{} // last values written
+	ltick  int64         // tick of last frame written
+	ctick  int64         // tick of last Write
+	begun  bool          // Write called
+	change []int
+	buf    [binary.MaxVarintLen64]byte
+	err    error
+}
+
+// NewWriter writes the header h to w, and returns a Writer
+// for writing frames.
+func NewWriter(w io.Writer, h *Header) (*Writer, error) {
+	tw := &Writer{h: h, w: bufio.NewWriter(w), last: h.ZeroValues()}
+	tw.write([]byte(magic))
+	tw.write([]byte{Version})
+	tw.uvarint(uint64(h.Tick))
+	var start int64
+	if !h.Start.IsZero() {
+		start = h.Start.UnixNano()
+	}
+	n := binary.PutVarint(tw.buf[:], start)
+	tw.write(tw.buf[:n])
+	tw.uvarint(uint64(len(h.Channels)))
+	for _, c := range h.Channels {
+		code, err := typecode(c.Type)
+		if err != nil {
+			return nil, err
+		}
+		tw.write([]byte{code})
+		tw.uvarint(uint64(len(c.Name)))
+		tw.write([]byte(c.Name))
+	}
+	if tw.err != nil {
+		return nil, tw.err
+	}
+	return tw, nil
+}
+
+// Write records values at tick. Values must be bool, float64 or int
+// according to the channel types in the header. Ticks must be written
+// in increasing order.
+func (w *Writer) Write(tick int64, values []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(values) != len(w.last) {
+		return fmt.Errorf("trace: %d values for %d channels", len(values), len(w.last))
+	}
+	if tick < 0 || (w.begun && tick <= w.ctick) {
+		return fmt.Errorf("trace: tick %d written after %d", tick, w.ctick)
+	}
+	w.ctick, w.begun = tick, true
+	w.change = w.change[:0]
+	for i, v := range values {
+		if !valid(w.h.Channels[i].Type, v) {
+			return fmt.Errorf("trace: invalid value %#v for channel '%s'", v, w.h.Channels[i].Name)
+		}
+		if v != w.last[i] {
+			w.change = append(w.change, i)
+		}
+	}
+	if len(w.change) == 0 {
+		return nil
+	}
+	w.frame(tick)
+	for _, i := range w.change {
+		w.uvarint(uint64(i))
+		switch x := values[i].(type) {
+		case bool:
+			var b byte
+			if x {
+				b = 1
+			}
+			w.write([]byte{b})
+		case int:
+			w.write([]byte{byte(x)})
+		case float64:
+			binary.LittleEndian.PutUint64(w.buf[:8], math.Float64bits(x))
+			w.write(w.buf[:8])
+		}
+		w.last[i] = values[i]
+	}
+	return w.err
+}
+
+// Close marks the end of the trace at the tick of the last Write,
+// and flushes buffered data. It does not close the underlying io.Writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.ctick != w.ltick {
+		w.change = w.change[:0]
+		w.frame(w.ctick)
+	}
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+func valid(t block.PortType, v interface{}) bool {
+	switch v.(type) {
+	case bool:
+		return t == block.Bool
+	case float64:
+		return t == block.Float64
+	case int:
+		return t == block.Int
+	}
+	return false
+}
+
+func (w *Writer) frame(tick int64) {
+	w.uvarint(uint64(tick - w.ltick))
+	w.uvarint(uint64(len(w.change)))
+	w.ltick = tick
+}
+
+func (w *Writer) uvarint(v uint64) {
+	n := binary.PutUvarint(w.buf[:], v)
+	w.write(w.buf[:n])
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/tajtiattila/joyster/block/parser"
+	"io/ioutil"
+	"os"
+)
+
+// format implements the fmt command that writes configs in canonical form.
+func format(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write result to the source file instead of standard output")
+	list := fs.Bool("l", false, "list files whose formatting differs")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		if *write || *list {
+			return fmt.Errorf("-w and -l need files")
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		out, err := parser.Format(src)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	for _, fn := range fs.Args() {
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		out, err := parser.Format(src)
+		if err != nil {
+			return fmt.Errorf("%s: %v", fn, err)
+		}
+		if *list && !bytes.Equal(src, out) {
+			fmt.Println(fn)
+		}
+		if *write {
+			if !bytes.Equal(src, out) {
+				if err := ioutil.WriteFile(fn, out, 0644); err != nil {
+					return err
+				}
+			}
+		} else if !*list {
+			if _, err := os.Stdout.Write(out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/parser"
+	"github.com/tajtiattila/joyster/block/trace/tracetest"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatGolden checks that formatting configs keeps their meaning.
+func TestFormatGolden(t *testing.T) {
+	fns, err := filepath.Glob("examples/*.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range append(fns, "joyster.cfg") {
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		out, err := parser.Format(src)
+		if err != nil {
+			t.Errorf("%s: %v", fn, err)
+			continue
+		}
+		golden := filepath.Join("testdata", strings.TrimSuffix(filepath.Base(fn), ".cfg")+".golden")
+		tracetest.Golden(t, string(out), block.DefaultTypeMap, "testdata/input.trace", golden)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/tajtiattila/joyster/block"
+)
+
+// lint implements the lint command that reports likely mistakes in configs.
+func lint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Parse(args)
+
+	fns := fs.Args()
+	if len(fns) == 0 {
+		fns = []string{"joyster.cfg"}
+	}
+	n := 0
+	for _, fn := range fns {
+		warns, err := block.Lint(fn)
+		if err != nil {
+			return err
+		}
+		for _, w := range warns {
+			fmt.Println(w)
+		}
+		n += len(warns)
+	}
+	if n != 0 {
+		return fmt.Errorf("%d warnings", n)
+	}
+	return nil
+}
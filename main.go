@@ -4,11 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
 	_ "github.com/tajtiattila/joyster/block/device/vjoy"
 	_ "github.com/tajtiattila/joyster/block/device/xinput"
 	_ "github.com/tajtiattila/joyster/block/logic"
-	"github.com/tajtiattila/vjoy"
+	"github.com/tajtiattila/joyster/block/parser"
+	"github.com/tajtiattila/joyster/block/trace"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,12 +28,19 @@ func main() {
 		test   bool
 		debugl string
 		debug  []string
+		recfn  string
+		playfn string
+		outfn  string
 	)
 
 	flag.BoolVar(&quiet, "quiet", false, "don't print info at startup")
 	flag.BoolVar(&prtver, "version", false, "print version and exit")
 	flag.BoolVar(&test, "test", false, "test config and exit")
 	flag.StringVar(&debugl, "debug", "", "comma separated list of blocks to debug blocks")
+	flag.StringVar(&recfn, "record", "", "record gamepad input to trace file")
+	flag.StringVar(&playfn, "replay", "", "run config offline using gamepad input from trace file")
+	flag.StringVar(&outfn, "out", "", "write vjoy output to trace file in replay mode")
+	flag.Var(defines(block.Defines), "D", "set config value `name=value` overriding the config, value defaults to 1, values other than numbers are strings")
 	//flag.BoolVar(webgui, "web", false, "enable web gui")
 	//flag.String(addr, "addr", ":7489", "web gui address")  // "JY"
 	//flag.String(sharedir, "share", "share", "share directory") // "JY"
@@ -39,16 +50,34 @@ func main() {
 		debug = strings.Split(debugl, ",")
 	}
 
+	if flag.NArg() > 0 && flag.Arg(0) == "types" {
+		if err := types(flag.Args()[1:]); err != nil {
+			abort(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "lint" {
+		if err := lint(flag.Args()[1:]); err != nil {
+			abort(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "fmt" {
+		if err := format(flag.Args()[1:]); err != nil {
+			abort(err)
+		}
+		return
+	}
+
 	if flag.NArg() > 1 {
 		abort("exactly one config parameter required")
 	}
 
-	if !quiet {
-		fmt.Println("joyster version:", Version)
-		fmt.Println("vJoy version:", vjoy.Version())
-		fmt.Println("  Product:       ", vjoy.ProductString())
-		fmt.Println("  Manufacturer:  ", vjoy.ManufacturerString())
-		fmt.Println("  Serial number: ", vjoy.SerialNumberString())
+	if prtver {
+		fmt.Println(Version)
+		return
 	}
 
 	fn := "joyster.cfg"
@@ -56,15 +85,57 @@ func main() {
 		fn = flag.Arg(0)
 	}
 
-	exit := test
-	if prtver {
-		fmt.Println(Version)
-		exit = true
+	if test {
+		if err := check(fn); err != nil {
+			abort(err)
+		}
+		if !quiet {
+			fmt.Println(fn, "ok")
+		}
+		return
+	}
+
+	if !quiet {
+		fmt.Println("joyster version:", Version)
+		for _, s := range device.Default.Info() {
+			fmt.Println(s)
+		}
 	}
-	if exit {
+
+	if playfn != "" {
+		if recfn != "" {
+			abort("-record and -replay can't be used together")
+		}
+		if err := replay(fn, playfn, outfn); err != nil {
+			abort(err)
+		}
 		return
 	}
 
+	var rec *trace.Recorder
+	backend := device.Default // wrapped by rec while recording
+	stoprec := func() {
+		if err := rec.Close(); err != nil {
+			fmt.Println("record:", err)
+		}
+		device.Default = backend
+		rec = nil
+	}
+	if recfn != "" {
+		f, err := os.Create(recfn)
+		if err != nil {
+			abort(err)
+		}
+		rec = trace.NewRecorder(backend, f)
+		device.Default = rec
+		defer func() {
+			// rec is nil if recording was stopped
+			if rec != nil {
+				stoprec()
+			}
+		}()
+	}
+
 	prof, err := block.Load(fn)
 	if err != nil {
 		abort(err)
@@ -81,20 +152,40 @@ func main() {
 		chdbg = make(chan time.Time)
 	}
 
-	chcfg := autoloadconfig(fn)
+	chsig := make(chan os.Signal, 1)
+	signal.Notify(chsig, os.Interrupt)
+
+	chcfg := autoloadconfig(fn, prof)
 	d := prof.D
 	cht := time.Tick(d)
+	var tick int64
+	if rec != nil {
+		rec.Tick = d
+	}
 	for {
 		select {
 		case nprof := <-chcfg:
 			if nprof.D != d {
 				d = nprof.D
 				cht = time.Tick(d)
+				if rec != nil {
+					fmt.Println("record: Update changed, recording stopped")
+					stoprec()
+				}
 			}
 			prof.Close()
 			prof = nprof
 		case <-cht:
 			prof.Tick()
+			if rec != nil {
+				if err := rec.Record(tick); err != nil {
+					fmt.Println("record:", err)
+					stoprec()
+				}
+			}
+			tick++
+		case <-chsig:
+			return
 		case <-chdbg:
 			fmt.Println()
 			block.DebugOutput(os.Stdout, prof, debug...)
@@ -102,33 +193,184 @@ func main() {
 	}
 }
 
+// check loads config fn using stub devices, and runs its first tick.
+func check(fn string) error {
+	device.Default = trace.NewIdlePlayer(device.NewFake(), device.NumGamepads)
+	prof, err := block.Load(fn)
+	if err != nil {
+		return err
+	}
+	return prof.Close()
+}
+
+// replay runs config fn offline using input from trace playfn,
+// and writes sink inputs to trace outfn if it is not empty.
+func replay(fn, playfn, outfn string) error {
+	f, err := os.Open(playfn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := trace.NewReader(f)
+	if err != nil {
+		return err
+	}
+	player, err := trace.NewPlayer(device.NewFake(), r)
+	if err != nil {
+		return err
+	}
+	device.Default = player
+
+	prof, err := block.Load(fn)
+	if err != nil {
+		return err
+	}
+	defer prof.Close()
+
+	var out *os.File
+	if outfn != "" {
+		if out, err = os.Create(outfn); err != nil {
+			return err
+		}
+	}
+	var n int64
+	if out != nil {
+		n, err = trace.Run(prof, player, out)
+		// the trace is incomplete if it can't be closed
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	} else {
+		n, err = trace.Run(prof, player, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("%d ticks (%v) replayed\n", n, time.Duration(n)*prof.D)
+	}
+	return nil
+}
+
+// defines sets config values from the command line.
+type defines map[string]interface{}
+
+func (d defines) String() string {
+	var v []string
+	for n, x := range d {
+		v = append(v, fmt.Sprintf("%s=%v", n, x))
+	}
+	return strings.Join(v, " ")
+}
+
+// Set sets a value given as name=value. Values that are
+// not numbers are used as strings.
+func (d defines) Set(s string) error {
+	n, v := s, "1"
+	if i := strings.IndexByte(s, '='); i != -1 {
+		n, v = s[:i], s[i+1:]
+	}
+	if n == "" {
+		return fmt.Errorf("name missing in %q", s)
+	}
+	if x, err := strconv.ParseFloat(v, 64); err == nil {
+		d[n] = x
+	} else {
+		d[n] = v
+	}
+	return nil
+}
+
 func abort(a ...interface{}) {
 	fmt.Println(a...)
 	os.Exit(1)
 }
 
-func autoloadconfig(fn string) <-chan *block.Profile {
+// autoloadconfig reloads config fn whenever any of the files
+// it consists of changes. Files are initially those of prof.
+// Files having errors are watched too after a failed reload.
+func autoloadconfig(fn string, prof *block.Profile) <-chan *block.Profile {
 	ch := make(chan *block.Profile)
-	if fi, err := os.Stat(fn); err == nil {
-		t := fi.ModTime()
-		go func() {
-			for {
-				if fi, err := os.Stat(fn); err == nil && fi.ModTime().After(t) {
-					t = fi.ModTime()
-					if prof, err := block.Load(fn); err == nil {
-						ch <- prof
-						if !quiet {
-							fmt.Println("new config loaded")
+	mt, err := modtimes(prof.Files)
+	if err != nil {
+		panic("autoloadcfg " + err.Error())
+	}
+	go func() {
+		for {
+			time.Sleep(time.Second)
+			if !changed(mt) {
+				continue
+			}
+			if nmt, err := modtimes(keys(mt)); err == nil {
+				mt = nmt
+			}
+			if prof, err := block.Load(fn); err == nil {
+				// included files might have changed
+				if nmt, err := modtimes(prof.Files); err == nil {
+					mt = nmt
+				}
+				ch <- prof
+				if !quiet {
+					fmt.Println("new config loaded")
+				}
+			} else {
+				fmt.Println(err)
+				// files with errors might have been included since the last load
+				for _, fn := range errfiles(err) {
+					if _, ok := mt[fn]; !ok {
+						if fi, err := os.Stat(fn); err == nil {
+							mt[fn] = fi.ModTime()
 						}
-					} else {
-						fmt.Println(err)
 					}
 				}
-				time.Sleep(time.Second)
 			}
-		}()
-	} else {
-		panic("autoloadcfg " + fn + err.Error())
-	}
+		}
+	}()
 	return ch
 }
+
+// errfiles returns the names of the files err reports problems in.
+func errfiles(err error) []string {
+	var v []string
+	switch e := err.(type) {
+	case parser.ErrorList:
+		for _, x := range e {
+			v = append(v, errfiles(x)...)
+		}
+	case *parser.Error:
+		if e.File != "" {
+			v = append(v, e.File)
+		}
+	}
+	return v
+}
+
+func modtimes(files []string) (map[string]time.Time, error) {
+	m := make(map[string]time.Time)
+	for _, fn := range files {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return nil, err
+		}
+		m[fn] = fi.ModTime()
+	}
+	return m, nil
+}
+
+// changed reports if any of the files in mt were modified.
+func changed(mt map[string]time.Time) bool {
+	for fn, t := range mt {
+		if fi, err := os.Stat(fn); err == nil && fi.ModTime().After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func keys(mt map[string]time.Time) []string {
+	v := make([]string, 0, len(mt))
+	for fn := range mt {
+		v = append(v, fn)
+	}
+	return v
+}
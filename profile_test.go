@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
 	_ "github.com/tajtiattila/joyster/block/device/vjoy"
 	_ "github.com/tajtiattila/joyster/block/device/xinput"
 	_ "github.com/tajtiattila/joyster/block/logic"
+	"github.com/tajtiattila/joyster/block/parser"
+	"github.com/tajtiattila/joyster/block/trace/tracetest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -27,9 +35,9 @@ conn output.v headlook.y
 
 # buttons
 
-conn output.1 [or abtn ta.break]
-conn output.2 bbtn
-conn output.3 xbtn
+conn output.1 [or abtn.1 ta.break]
+conn output.2 bbtn.1
+conn output.3 xbtn.1
 conn output.4 ybtn.1
 
 conn output.5 abtn.2
@@ -40,23 +48,23 @@ conn output.8 ybtn.2
 conn output.9 shift0
 conn output.10 shift1
 
-conn output.11 [if plane1 input.buttona off]
-conn output.12 [if plane1 input.buttonb off]
-conn output.13 [if plane1 input.buttonx off]
-conn output.14 [if plane1 input.buttony off]
+conn output.11 [if plane1 input.a off]
+conn output.12 [if plane1 input.b off]
+conn output.13 [if plane1 input.x off]
+conn output.14 [if plane1 input.y off]
 
-conn output.15 [if plane2 input.buttona off]
-conn output.16 [if plane2 input.buttonb off]
-conn output.17 [if plane2 input.buttonx off]
-conn output.18 [if plane2 input.buttony off]
+conn output.15 [if plane2 input.a off]
+conn output.16 [if plane2 input.b off]
+conn output.17 [if plane2 input.x off]
+conn output.18 [if plane2 input.y off]
 
 conn output.19 [and fight input.ltrigger]
 conn output.20 [and fight input.rtrigger]
 
-conn output.21 [if plane3 input.buttona off]
-conn output.22 [if plane3 input.buttonb off]
-conn output.23 [if plane3 input.buttonx off]
-conn output.24 [if plane3 input.buttony off]
+conn output.21 [if plane3 input.a off]
+conn output.22 [if plane3 input.b off]
+conn output.23 [if plane3 input.x off]
+conn output.24 [if plane3 input.y off]
 
 # hats
 
@@ -98,15 +106,15 @@ block plane1 [and shift0 [not shift1]]
 block plane2 [and [not shift0] shift1]
 block plane3 [and shift0 shift1]
 
-block ta [triggeraxis input.lt input.rt: AxisThreshold=0.15 BreakThreshold=0.05 Exp=1.5]
+block ta [pedals input.lt input.rt: AxisThreshold=0.15 BreakThreshold=0.05 Exp=1.5]
 
-block abtn [multibutton [if plane0 input.buttona off]: 2]
+block abtn [multibutton [if plane0 input.a off]: 2]
 
-block bbtn [multibutton [if plane0 input.buttonb off]: 2]
+block bbtn [multibutton [if plane0 input.b off]: 2]
 
-block xbtn [multibutton [if plane0 input.buttonx off]: 2]
+block xbtn [multibutton [if plane0 input.x off]: 2]
 
-block ybtn [multibutton [if plane0 input.buttony off]: 2]
+block ybtn [multibutton [if plane0 input.y off]: 2]
 
 block rolltoyaw [toggle input.lthumb]
 block fight [toggle input.back]
@@ -142,7 +150,7 @@ conn rs.y input.ry
 block headlook [headlook: MovePerSec=2.0 AutoCenterDist=0.2 AutoCenterAccel=0.001 JumpToCenterAccel=0.1]
 conn headlook.x [if headlooktoggle rs.x 0]
 conn headlook.y [if headlooktoggle rs.y 0]
-conn headlook.enable headlooktoggle
+conn headlook.reset headlooktoggle
 `
 
 func TestLoad(t *testing.T) {
@@ -151,3 +159,279 @@ func TestLoad(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestLoadConfigs(t *testing.T) {
+	fns, err := filepath.Glob("examples/*.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range append(fns, "joyster.cfg") {
+		prof, err := block.Load(fn)
+		if err != nil {
+			t.Errorf("%s: %v", fn, err)
+			continue
+		}
+		prof.Close()
+	}
+}
+
+func TestGolden(t *testing.T) {
+	fns, err := filepath.Glob("examples/*.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range append(fns, "joyster.cfg") {
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		golden := filepath.Join("testdata", strings.TrimSuffix(filepath.Base(fn), ".cfg")+".golden")
+		tracetest.Golden(t, string(src), block.DefaultTypeMap, "testdata/input.trace", golden)
+	}
+}
+
+// withFake sets fake devices as the default, and returns them
+// with a function restoring the previous default.
+func withFake() (*device.Fake, func()) {
+	fake := device.NewFake()
+	saved := device.Default
+	device.Default = fake
+	return fake, func() { device.Default = saved }
+}
+
+func TestFakeDevices(t *testing.T) {
+	fake, restore := withFake()
+	defer restore()
+
+	prof, err := block.Parse(`
+block input [gamepad]
+block output [vjoy]
+conn output.x input.lx
+conn output.1 input.a
+conn output.hat1 input.dpad
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pad, joy := fake.Gamepad(0), fake.Joystick(1)
+	pad.State.LX = 0.5
+	pad.State.A = true
+	pad.State.Dpad = block.HatNorth
+	prof.Tick()
+	if joy.Axes[0] != 0.5 || !joy.Buttons[0] || joy.Hats[0] != block.HatNorth {
+		t.Errorf("unexpected joystick state: %v %v %v", joy.Axes[0], joy.Buttons[0], joy.Hats[0])
+	}
+
+	prof.Close()
+	if pad.Open != 0 || joy.Open != 0 {
+		t.Errorf("devices left open: gamepad %d, joystick %d", pad.Open, joy.Open)
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	fake, restore := withFake()
+	defer restore()
+
+	_, err := block.Parse(`
+block input [gamepad]
+block a [vjoy:Device=-1]
+conn a.x input.lx
+block b [vjoy]
+conn b.x input.ly
+block c [vjoy:Device=-2]
+conn c.x input.rx
+`)
+	errs, ok := err.(parser.ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("want 2 errors, got %v", err)
+	}
+	for i, lno := range []string{"line 3", "line 7"} {
+		if !strings.Contains(errs[i].Error(), lno) {
+			t.Errorf("error %d has no %s: %v", i, lno, errs[i])
+		}
+	}
+	if pad, joy := fake.Gamepad(0), fake.Joystick(1); pad.Open != 0 || joy.Open != 0 {
+		t.Errorf("devices left open: gamepad %d, joystick %d", pad.Open, joy.Open)
+	}
+}
+
+func TestErrFiles(t *testing.T) {
+	_, restore := withFake()
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "joyster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn, inc := filepath.Join(dir, "main.cfg"), filepath.Join(dir, "inc.cfg")
+	for name, src := range map[string]string{
+		fn:  "block input [gamepad]\nblock output [vjoy]\ninclude \"inc.cfg\"\n",
+		inc: "conn output.x [deadzon input.lx: 0.1]\n",
+	} {
+		if err := ioutil.WriteFile(name, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = block.Load(fn)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if v := errfiles(err); len(v) != 1 || v[0] != inc {
+		t.Errorf("files with errors are %v, want %s", v, inc)
+	}
+}
+
+func TestParamPorts(t *testing.T) {
+	_, restore := withFake()
+	defer restore()
+
+	src := `
+block input [gamepad]
+block output [vjoy]
+set TapDelay=0.2 KeepPushed=0.25
+block mybtn [multibutton input.a: 3]
+conn output.1 mybtn.3
+`
+	if _, err := block.Parse(src); err != nil {
+		t.Fatal(err)
+	}
+	_, err := block.Parse(src + "conn output.2 mybtn.5\n")
+	errs, ok := err.(parser.ErrorList)
+	if !ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 7") {
+		t.Fatalf("want single error on line 7, got %v", err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	fake, restore := withFake()
+	defer restore()
+
+	prof, err := block.Parse(`
+block input [gamepad]
+block output [vjoy]
+block latch [or input.a [and prev [not input.b]]]
+block prev [delay latch: bool]
+conn output.1 latch
+block count [add prevcount 0.125]
+block prevcount [delay count]
+conn output.x count
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prof.Close()
+
+	// count was incremented by the test tick when the profile was loaded
+	pad, joy := fake.Gamepad(0), fake.Joystick(1)
+	for i, tt := range []struct {
+		a, b  bool
+		latch bool
+		count float64
+	}{
+		{false, false, false, 0.25},
+		{true, false, true, 0.375},
+		{false, false, true, 0.5},
+		{false, true, false, 0.625},
+		{false, false, false, 0.75},
+	} {
+		pad.State.A, pad.State.B = tt.a, tt.b
+		prof.Tick()
+		if joy.Buttons[0] != tt.latch || joy.Axes[0] != tt.count {
+			t.Errorf("tick %d: got %v %v, want %v %v", i, joy.Buttons[0], joy.Axes[0], tt.latch, tt.count)
+		}
+	}
+}
+
+func TestLayer(t *testing.T) {
+	fake, restore := withFake()
+	defer restore()
+
+	prof, err := block.Parse(`
+block input [gamepad]
+block output [vjoy]
+port shift input.lbumper
+conn output.1 input.b
+layer base !shift
+	conn output.x input.lx
+	conn output.hat1 input.dpad
+end
+layer alt shift
+	conn output.1 input.a
+	conn output.hat2 input.dpad
+end
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prof.Close()
+
+	pad, joy := fake.Gamepad(0), fake.Joystick(1)
+	pad.State.A, pad.State.LX, pad.State.Dpad = true, 0.5, block.HatNorth
+	for i, tt := range []struct {
+		shift      bool
+		b          bool
+		btn        bool
+		x          float64
+		hat1, hat2 int
+	}{
+		{false, false, false, 0.5, block.HatNorth, block.HatCentre},
+		{false, true, true, 0.5, block.HatNorth, block.HatCentre},
+		{true, false, true, 0, block.HatCentre, block.HatNorth},
+	} {
+		pad.State.LBumper, pad.State.B = tt.shift, tt.b
+		prof.Tick()
+		if joy.Buttons[0] != tt.btn || joy.Axes[0] != tt.x || joy.Hats[0] != tt.hat1 || joy.Hats[1] != tt.hat2 {
+			t.Errorf("tick %d: got %v %v %v %v, want %v %v %v %v", i,
+				joy.Buttons[0], joy.Axes[0], joy.Hats[0], joy.Hats[1], tt.btn, tt.x, tt.hat1, tt.hat2)
+		}
+	}
+}
+
+func TestDebugOutput(t *testing.T) {
+	_, restore := withFake()
+	defer restore()
+
+	prof, err := block.Parse(`
+block input [gamepad]
+block output [vjoy]
+def filter(x: Dz) -> (y)
+	block dz [deadzone x: Dz]
+	out y [multiply dz: 2]
+end
+block ls [filter input.lx: 0.1]
+block g { a b
+	$[not]
+}
+conn g.a input.a
+conn g.b input.b
+conn output.x ls
+conn output.1 g.a
+conn output.2 g.b
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prof.Close()
+
+	for _, tt := range []struct {
+		name string
+		want []string
+	}{
+		{"ls", []string{"ls/dz", "ls/«multiply:6»"}},
+		{"g", []string{"g#0.a", "g#0.b"}},
+		{"ls/dz", []string{"ls/dz"}},
+	} {
+		var buf bytes.Buffer
+		block.DebugOutput(&buf, prof, tt.name)
+		var got []string
+		for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			got = append(got, strings.Fields(l)[0])
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("-debug %s shows %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+//go:build ignore
+// +build ignore
+
+// mkinput generates input.trace, a scripted gamepad session
+// used by golden trace tests of the configs.
+//
+//	go run testdata/mkinput.go
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/tajtiattila/joyster/block"
+	"github.com/tajtiattila/joyster/block/device"
+	"github.com/tajtiattila/joyster/block/trace"
+)
+
+const tickfreq = 1000 // ticks per second
+
+var (
+	s     device.GamepadState
+	tick  int64
+	w     *trace.Writer
+	ports []block.MapDecl
+)
+
+func main() {
+	f, err := os.Create("testdata/input.trace")
+	if err != nil {
+		log.Fatal(err)
+	}
+	h := &trace.Header{Tick: time.Second / tickfreq, Start: time.Unix(1420070400, 0)}
+	ports = s.Ports()
+	for _, d := range ports {
+		h.Channels = append(h.Channels, trace.Channel{"gamepad0." + d.N, block.TypeOf(d.V)})
+	}
+	if w, err = trace.NewWriter(f, h); err != nil {
+		log.Fatal(err)
+	}
+
+	// sticks: sweep axes
+	for _, ax := range []*float64{&s.LX, &s.LY, &s.RX, &s.RY} {
+		ramp(ax, 0, 1, 0.5)
+		ramp(ax, 1, -1, 1)
+		ramp(ax, -1, 0, 0.5)
+	}
+	// both sticks in a diagonal
+	s.LX, s.LY, s.RX, s.RY = 0.7, 0.7, -0.7, 0.7
+	wait(0.5)
+	s.LX, s.LY, s.RX, s.RY = 0, 0, 0, 0
+	wait(0.5)
+
+	// triggers
+	ramp(&s.LT, 0, 1, 0.5)
+	ramp(&s.LT, 1, 0, 0.5)
+	ramp(&s.RT, 0, 1, 0.5)
+	ramp(&s.RT, 1, 0, 0.5)
+	s.LT, s.RT = 0.6, 0.6
+	wait(0.3)
+	s.LT, s.RT = 0, 0
+	wait(0.3)
+
+	// face buttons: single, double and long presses
+	for _, b := range []*bool{&s.A, &s.B, &s.X, &s.Y} {
+		press(b, 0.1)
+		wait(1)
+		press(b, 0.05)
+		wait(0.1)
+		press(b, 0.05)
+		wait(1)
+		press(b, 1.5)
+		wait(1)
+	}
+
+	// shift states
+	for _, shift := range [][]*bool{{&s.LBumper}, {&s.RBumper}, {&s.LBumper, &s.RBumper}} {
+		set(shift, true)
+		wait(0.2)
+		for _, b := range []*bool{&s.A, &s.B, &s.X, &s.Y} {
+			press(b, 0.1)
+			wait(0.2)
+		}
+		for _, d := range []int{block.HatNorth, block.HatEast, block.HatSouth, block.HatWest} {
+			s.Dpad = d
+			wait(0.1)
+			s.Dpad = block.HatCentre
+			wait(0.2)
+		}
+		set(shift, false)
+		wait(0.5)
+	}
+
+	// dpad single presses and combos
+	for _, d := range []int{block.HatNorth, block.HatEast, block.HatSouth, block.HatWest} {
+		s.Dpad = d
+		wait(0.1)
+		s.Dpad = block.HatCentre
+		wait(1)
+	}
+	for _, c := range [][2]int{{block.HatNorth, block.HatEast}, {block.HatWest, block.HatSouth}} {
+		s.Dpad = c[0]
+		wait(0.1)
+		s.Dpad = block.HatCentre
+		wait(0.1)
+		s.Dpad = c[1]
+		wait(0.1)
+		s.Dpad = block.HatCentre
+		wait(1)
+	}
+
+	// toggles: fight mode, roll to yaw, headlook
+	press(&s.Back, 0.1)
+	wait(0.5)
+	s.LX = 0.8
+	wait(0.5)
+	s.LX = 0
+	press(&s.LThumb, 0.1)
+	wait(0.5)
+	s.LX = 0.8
+	wait(0.5)
+	s.LX = 0
+	press(&s.LThumb, 0.1)
+	wait(0.5)
+	s.LT, s.RT = 0.8, 0
+	wait(0.5)
+	s.LT = 0
+	press(&s.Back, 0.1)
+	wait(0.5)
+
+	press(&s.RThumb, 0.1)
+	wait(0.2)
+	s.RX, s.RY = 0.5, -0.5
+	wait(1)
+	s.RX, s.RY = 0, 0
+	wait(2)
+	press(&s.RThumb, 0.1)
+	wait(1)
+
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// wait records the current state for d seconds
+func wait(d float64) {
+	for n := int64(d * tickfreq); n > 0; n-- {
+		record()
+	}
+}
+
+// ramp moves v from a to b within d seconds
+func ramp(v *float64, a, b, d float64) {
+	n := int64(d * tickfreq)
+	for i := int64(0); i < n; i++ {
+		// change value every 10 ticks like real devices
+		if i%10 == 0 {
+			*v = a + (b-a)*float64(i)/float64(n)
+		}
+		record()
+	}
+	*v = b
+}
+
+func press(b *bool, d float64) {
+	*b = true
+	wait(d)
+	*b = false
+}
+
+func set(v []*bool, value bool) {
+	for _, b := range v {
+		*b = value
+	}
+}
+
+func record() {
+	values := make([]interface{}, len(ports))
+	for i, d := range ports {
+		switch x := d.V.(type) {
+		case *bool:
+			values[i] = *x
+		case *float64:
+			values[i] = *x
+		case *int:
+			values[i] = *x
+		}
+	}
+	if err := w.Write(tick, values); err != nil {
+		log.Fatal(err)
+	}
+	tick++
+}
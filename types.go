@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/tajtiattila/joyster/block"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	readmeStart = "Block types\n-----------\n"
+	readmeEnd   = "\nExample config\n--------------\n"
+)
+
+// readmeIntro starts the block types section of README.md.
+const readmeIntro = `
+A list of supported block types follows. This section is generated
+using ` + "`joyster types -readme README.md`" + `.
+
+Some blocks have parameters. The actual unit of numeric parameter values
+typically fall into one of the following categories:
+
+* relative axis value
+* time in seconds (fractions are supported)
+* axis value per second
+* boolean flag (nonzero meaning true)
+
+Each block type declares its parameters along with their unit and valid
+range. Named parameters unknown to the block type are reported as errors
+(with the most similar parameter name suggested), and so are values out
+of range.
+`
+
+// types implements the types command that lists block types.
+func types(args []string) error {
+	fs := flag.NewFlagSet("types", flag.ExitOnError)
+	readme := fs.String("readme", "", "regenerate the block types section of markdown `file`")
+	fs.Parse(args)
+
+	if *readme != "" {
+		return updateReadme(*readme)
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = typeNames()
+	}
+	for i, n := range names {
+		t, ok := block.DefaultTypeMap[n]
+		if !ok {
+			return fmt.Errorf("unknown type '%s'", n)
+		}
+		ti, err := block.Info(t)
+		if err != nil {
+			return err
+		}
+		if i != 0 {
+			fmt.Println()
+		}
+		writeTypeText(os.Stdout, ti)
+	}
+	return nil
+}
+
+func typeNames() []string {
+	var v []string
+	for n := range block.DefaultTypeMap {
+		v = append(v, n)
+	}
+	sort.Strings(v)
+	return v
+}
+
+func writeTypeText(w io.Writer, ti *block.TypeInfo) {
+	fmt.Fprintf(w, "%s (%s): %s\n", ti.Name, ti.Doc.Category, ti.Doc.Summary)
+	if len(ti.Inputs) != 0 {
+		fmt.Fprintf(w, "  input:  %s\n", portList(ti.Inputs, false))
+	}
+	if len(ti.Outputs) != 0 {
+		fmt.Fprintf(w, "  output: %s\n", portList(ti.Outputs, false))
+	}
+	for _, n := range sortedKeys(ti.Doc.Ports) {
+		fmt.Fprintf(w, "  port %s: %s\n", portName(n, false), ti.Doc.Ports[n])
+	}
+	for _, s := range ti.Params {
+		fmt.Fprintf(w, "  param %s: %s, %s, %s", s.Name, s.Unit, paramRange(s), paramDefault(s))
+		if d := ti.Doc.Params[s.Name]; d != "" {
+			fmt.Fprintf(w, ": %s", d)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// updateReadme replaces the block types section of the markdown file fn.
+func updateReadme(fn string) error {
+	src, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	s := string(src)
+	i := strings.Index(s, readmeStart)
+	j := strings.Index(s, readmeEnd)
+	if i == -1 || j < i {
+		return fmt.Errorf("%s: block types section not found", fn)
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString(s[:i+len(readmeStart)])
+	if err := writeTypesMarkdown(buf); err != nil {
+		return err
+	}
+	buf.WriteString(s[j:])
+	return ioutil.WriteFile(fn, buf.Bytes(), 0666)
+}
+
+// writeTypesMarkdown writes the list of block types grouped by category.
+func writeTypesMarkdown(w io.Writer) error {
+	cats := make(map[string][]*block.TypeInfo)
+	for _, n := range typeNames() {
+		ti, err := block.Info(block.DefaultTypeMap[n])
+		if err != nil {
+			return err
+		}
+		cats[ti.Doc.Category] = append(cats[ti.Doc.Category], ti)
+	}
+	fmt.Fprint(w, readmeIntro)
+	for _, c := range append(block.Categories, block.Category{Name: "Other blocks"}) {
+		v := cats[c.Name]
+		if len(v) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n# %s\n", c.Name)
+		if c.Text != "" {
+			fmt.Fprintf(w, "\n%s\n", wrap(c.Text))
+		}
+		if c.Name == "Simple blocks" {
+			writeTypeTable(w, v)
+			continue
+		}
+		for _, ti := range v {
+			writeTypeMarkdown(w, ti)
+		}
+	}
+	return nil
+}
+
+func writeTypeTable(w io.Writer, v []*block.TypeInfo) {
+	fmt.Fprintln(w, "\n| Name | Input | Output | Description |")
+	fmt.Fprintln(w, "|------|-------|--------|-------------|")
+	for _, ti := range v {
+		fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", ti.Name,
+			portList(ti.Inputs, true), portList(ti.Outputs, true), ti.Doc.Summary)
+	}
+}
+
+func writeTypeMarkdown(w io.Writer, ti *block.TypeInfo) {
+	fmt.Fprintf(w, "\n## %s\n\n", ti.Name)
+	if ti.Doc.Text != "" {
+		fmt.Fprintf(w, "%s\n\n", wrap(ti.Doc.Text))
+	} else {
+		fmt.Fprintf(w, "`%s`: %s.\n\n", ti.Name, ti.Doc.Summary)
+	}
+	if len(ti.Inputs) != 0 {
+		fmt.Fprintf(w, "* Inputs: %s\n", portList(ti.Inputs, true))
+	}
+	if len(ti.Outputs) != 0 {
+		fmt.Fprintf(w, "* Outputs: %s\n", portList(ti.Outputs, true))
+	}
+	for _, n := range sortedKeys(ti.Doc.Ports) {
+		fmt.Fprintf(w, "* %s: %s\n", portName(n, true), ti.Doc.Ports[n])
+	}
+	if len(ti.Params) != 0 {
+		fmt.Fprintln(w, "\n| Parameter | Unit | Range | Default | Description |")
+		fmt.Fprintln(w, "|-----------|------|-------|---------|-------------|")
+		for _, s := range ti.Params {
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s |\n",
+				s.Name, s.Unit, paramRange(s), paramDefault(s), ti.Doc.Params[s.Name])
+		}
+	}
+	if ti.Doc.Example != "" {
+		fmt.Fprint(w, "\nExample:\n\n")
+		for _, line := range strings.Split(ti.Doc.Example, "\n") {
+			fmt.Fprintf(w, "\t%s\n", line)
+		}
+	}
+}
+
+func paramRange(s block.ParamSpec) string {
+	if s.Unit == block.Identifier {
+		return strings.Join(s.Choices, " or ")
+	}
+	if s.Min == s.Max {
+		return "any"
+	}
+	return fmt.Sprintf("%g .. %g", s.Min, s.Max)
+}
+
+func paramDefault(s block.ParamSpec) string {
+	if s.Required {
+		return "required"
+	}
+	if s.Unit == block.Identifier {
+		return s.Choices[0]
+	}
+	return fmt.Sprintf("%g", s.Default)
+}
+
+// portList describes ports grouped by type, such as "`x` `y` axis, `1` .. `32` bool".
+// Numbered ports in sequence are abbreviated.
+func portList(ports []block.PortInfo, md bool) string {
+	var groups []string
+	for i := 0; i < len(ports); {
+		j := i + 1
+		for j < len(ports) && ports[j].Type == ports[i].Type && ports[i].Name != "" && ports[j].Name != "" {
+			j++
+		}
+		var names []string
+		for k := i; k < j; {
+			l := numberRun(ports[k:j])
+			if l >= 3 {
+				names = append(names, portName(ports[k].Name, md)+" .. "+portName(ports[k+l-1].Name, md))
+				k += l
+			} else {
+				if ports[k].Name != "" {
+					names = append(names, portName(ports[k].Name, md))
+				}
+				k++
+			}
+		}
+		names = append(names, block.PortTypeName(ports[i].Type))
+		groups = append(groups, strings.Join(names, " "))
+		i = j
+	}
+	return strings.Join(groups, ", ")
+}
+
+// numberRun returns the number of ports at the start of v
+// named with consecutive numbers.
+func numberRun(v []block.PortInfo) int {
+	n, err := strconv.Atoi(v[0].Name)
+	if err != nil {
+		return 0
+	}
+	l := 1
+	for l < len(v) && v[l].Name == strconv.Itoa(n+l) {
+		l++
+	}
+	return l
+}
+
+func portName(n string, md bool) string {
+	switch {
+	case n == "":
+		return "unnamed"
+	case md:
+		return "`" + n + "`"
+	}
+	return n
+}
+
+func sortedKeys(m map[string]string) []string {
+	var v []string
+	for n := range m {
+		v = append(v, n)
+	}
+	sort.Strings(v)
+	return v
+}
+
+// wrap breaks the lines of the paragraphs in s to fit in 80 columns.
+func wrap(s string) string {
+	var paras []string
+	for _, p := range strings.Split(s, "\n\n") {
+		var lines []string
+		line := ""
+		for _, word := range strings.Fields(p) {
+			if line != "" && len(line)+1+len(word) > 80 {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		paras = append(paras, strings.Join(append(lines, line), "\n"))
+	}
+	return strings.Join(paras, "\n\n")
+}
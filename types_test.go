@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"github.com/tajtiattila/joyster/block"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadmeTypes(t *testing.T) {
+	src, err := ioutil.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(src)
+	i := strings.Index(s, readmeStart)
+	j := strings.Index(s, readmeEnd)
+	if i == -1 || j < i {
+		t.Fatal("block types section not found in README.md")
+	}
+	buf := new(bytes.Buffer)
+	if err := writeTypesMarkdown(buf); err != nil {
+		t.Fatal(err)
+	}
+	if s[i+len(readmeStart):j] != buf.String() {
+		t.Error("block types section of README.md is out of date, run 'joyster types -readme README.md'")
+	}
+}
+
+func TestPortList(t *testing.T) {
+	for _, tt := range []struct {
+		typ  string
+		in   bool
+		want string
+	}{
+		{"deadzone", true, "axis"},
+		{"add", true, "`1` .. `9` axis"},
+		{"eq", true, "`1` `2` any"},
+		{"lt", true, "`1` `2` axis"},
+		{"pedals", false, "axis, `break` bool"},
+		{"vjoy", true, "`x` `y` `z` `rx` `ry` `rz` `u` `v` axis, `hat1` `hat2` `hat3` `hat4` hat, `1` .. `32` bool"},
+	} {
+		ti, err := block.Info(block.DefaultTypeMap[tt.typ])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports := ti.Outputs
+		if tt.in {
+			ports = ti.Inputs
+		}
+		if got := portList(ports, true); got != tt.want {
+			t.Errorf("%s ports are %q, want %q", tt.typ, got, tt.want)
+		}
+	}
+}